@@ -7,7 +7,6 @@ import (
 
 	"github.com/andrew-d/wolf"
 	"github.com/andrew-d/wolf/middleware"
-	"github.com/zenazn/goji/graceful"
 	"golang.org/x/net/context"
 )
 
@@ -43,6 +42,15 @@ func main() {
 		fmt.Fprintf(w, "You gave me: %s\n", s)
 	})
 
-	log.Println("Started")
-	graceful.ListenAndServe(":3001", m)
+	m.OnStart(func() error {
+		log.Println("Started")
+		return nil
+	})
+	m.OnShutdown(func() {
+		log.Println("Shutting down")
+	})
+
+	if err := m.ListenAndServe(":3001"); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,134 @@
+package wolf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// Number of hex characters of the content hash that are put in a
+// fingerprinted file name.
+const fingerprintLength = 8
+
+// Assets is a manifest of content-fingerprinted names for a set of static
+// files.  The fingerprinted name of a file changes whenever its content does,
+// which lets browsers cache the file forever without ever serving stale
+// content.
+//
+// An Assets is created with App.Assets, and is safe for concurrent use.
+type Assets struct {
+	prefix string
+
+	// Maps the original name to the fingerprinted name, and vice versa.
+	fingerprints map[string]string
+	originals    map[string]string
+}
+
+// Assets hashes every file in fsys and serves them under the given path
+// prefix, as App.Static does.  The returned manifest is used to build URLs to
+// the fingerprinted names of the files (e.g. "app.3f9c1a2b.js" for
+// "app.js"), which are served with an immutable Cache-Control header.  The
+// original names continue to be served normally.
+//
+// Since the manifest is built once, files added or changed after this call
+// are not fingerprinted until the App is restarted.
+func (a *App) Assets(prefix string, fsys fs.FS) (*Assets, error) {
+	assets, err := newAssets(strings.TrimRight(prefix, "/"), fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mountStatic(&staticHandler{
+		fs:     fsys,
+		prefix: assets.prefix,
+		assets: assets,
+	})
+	return assets, nil
+}
+
+func newAssets(prefix string, fsys fs.FS) (*Assets, error) {
+	ret := &Assets{
+		prefix:       prefix,
+		fingerprints: make(map[string]string),
+		originals:    make(map[string]string),
+	}
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Precompressed files are served in place of their originals, so
+		// they don't need names of their own.
+		if d.IsDir() || strings.HasSuffix(name, ".gz") {
+			return nil
+		}
+
+		sum, err := hashFile(fsys, name)
+		if err != nil {
+			return err
+		}
+
+		fingerprinted := fingerprintName(name, sum)
+		ret.fingerprints[name] = fingerprinted
+		ret.originals[fingerprinted] = name
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func hashFile(fsys fs.FS, name string) (string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))[:fingerprintLength], nil
+}
+
+// fingerprintName inserts the hash before the extension of a file name.
+func fingerprintName(name, sum string) string {
+	ext := path.Ext(name)
+	if ext == path.Base(name) {
+		// Dotfiles like ".htaccess" have no extension to speak of.
+		ext = ""
+	}
+
+	return strings.TrimSuffix(name, ext) + "." + sum + ext
+}
+
+// Path returns the URL path of the fingerprinted version of the named file,
+// including the prefix the assets are served under.  If the file is not in
+// the manifest, the path to the original name is returned instead.
+func (a *Assets) Path(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if fingerprinted, ok := a.fingerprints[name]; ok {
+		name = fingerprinted
+	}
+
+	return a.prefix + "/" + name
+}
+
+// FuncMap returns template functions for use with html/template or
+// text/template.  It provides a single function, "asset", which is
+// Assets.Path:
+//
+//	<script src="{{ asset "app.js" }}"></script>
+func (a *Assets) FuncMap() map[string]interface{} {
+	return map[string]interface{}{
+		"asset": a.Path,
+	}
+}
@@ -0,0 +1,63 @@
+package wolf_test
+
+import (
+	"bytes"
+	"html/template"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/andrew-d/wolf"
+	"github.com/andrew-d/wolf/wolftest"
+)
+
+func TestFingerprintName(t *testing.T) {
+	a := wolf.New()
+	assets, err := a.Assets("/", fstest.MapFS{
+		"app.js":           {Data: []byte("app")},
+		"css/site.min.css": {Data: []byte("site")},
+		"LICENSE":          {Data: []byte("license")},
+		".htaccess":        {Data: []byte("htaccess")},
+	})
+	assert.NoError(t, err)
+
+	assert.Regexp(t, `^/app\.[0-9a-f]{8}\.js$`, assets.Path("app.js"))
+	assert.Regexp(t, `^/css/site\.min\.[0-9a-f]{8}\.css$`, assets.Path("css/site.min.css"))
+	assert.Regexp(t, `^/LICENSE\.[0-9a-f]{8}$`, assets.Path("LICENSE"))
+	assert.Regexp(t, `^/\.htaccess\.[0-9a-f]{8}$`, assets.Path(".htaccess"))
+}
+
+func TestAssets(t *testing.T) {
+	a := wolf.New()
+	assets, err := a.Assets("/static/", testFS)
+	assert.NoError(t, err)
+
+	p := assets.Path("app.js")
+	assert.Regexp(t, `^/static/app\.[0-9a-f]{8}\.js$`, p)
+	assert.Equal(t, "/static/missing.js", assets.Path("missing.js"))
+
+	// Precompressed siblings don't get their own names
+	assert.Equal(t, "/static/app.js.gz", assets.Path("app.js.gz"))
+
+	// The fingerprinted name is served with an immutable cache header
+	resp := wolftest.NewRequest("GET", p).Serve(a)
+	resp.AssertStatus(t, 200)
+	resp.AssertBody(t, "console.log(1)")
+	assert.Contains(t, resp.Header.Get("Cache-Control"), "immutable")
+
+	resp = wolftest.NewRequest("GET", p).WithHeader("Accept-Encoding", "gzip").Serve(a)
+	resp.AssertBody(t, "gzipped")
+
+	// The original is still available, but not immutable
+	resp = wolftest.NewRequest("GET", "/static/app.js").Serve(a)
+	resp.AssertStatus(t, 200)
+	assert.Empty(t, resp.Header.Get("Cache-Control"))
+
+	// Template helper
+	tmpl := template.Must(template.New("").Funcs(assets.FuncMap()).Parse(
+		`<script src="{{ asset "app.js" }}"></script>`))
+	var buf bytes.Buffer
+	assert.NoError(t, tmpl.Execute(&buf, nil))
+	assert.Equal(t, `<script src="`+p+`"></script>`, buf.String())
+}
@@ -0,0 +1,106 @@
+// Package debug serves handlers for debugging a running wolf.App: profiles,
+// expvar variables, goroutine stacks and the App's routes.
+//
+// It is separate from wolf because importing it also imports net/http/pprof
+// and expvar, which register their handlers with http.DefaultServeMux, so
+// don't serve that mux publicly in programs that use it.
+package debug
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	rpprof "runtime/pprof"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf"
+)
+
+// Mount registers handlers for debugging the given App under the given prefix
+// (e.g. "/debug"):
+//
+//	prefix/pprof/       net/http/pprof's profiles, for "go tool pprof"
+//	prefix/vars         expvar's variables, as JSON
+//	prefix/goroutines   the stacks of all goroutines, as text
+//	prefix/routes       the App's middleware and routes, as JSON
+//
+// Requests for these routes skip the App's middleware, so that middleware
+// like Timeout doesn't interrupt long-running profiles, and only go through
+// auth, which should check that the client is allowed to debug the App:
+//
+//	debug.Mount(a, "/debug", middleware.BasicAuth("debug", admins))
+//
+// auth may be nil if the App is only reachable by trusted clients.  Other
+// paths under the prefix go through the App's middleware as usual.
+func Mount(a *wolf.App, prefix string, auth wolf.MiddlewareType) {
+	prefix = strings.TrimSuffix(prefix, "/")
+
+	wrap := func(h wolf.HandlerType) wolf.HandlerType {
+		if auth == nil {
+			return h
+		}
+		return wolf.With(h, auth)
+	}
+
+	pprofHandler := wrap(wolf.HandlerFunc(servePprof))
+	a.HandleWithoutMiddleware("GET", prefix+"/pprof/*name", pprofHandler)
+	a.HandleWithoutMiddleware("POST", prefix+"/pprof/*name", pprofHandler)
+	a.HandleWithoutMiddleware("GET", prefix+"/vars", wrap(expvar.Handler()))
+	a.HandleWithoutMiddleware("GET", prefix+"/goroutines", wrap(http.HandlerFunc(serveGoroutines)))
+	a.HandleWithoutMiddleware("GET", prefix+"/routes", wrap(routesHandler(a)))
+}
+
+// servePprof dispatches to net/http/pprof's handlers.  Its Index handler
+// only serves named profiles under "/debug/pprof/", so they're handled here.
+func servePprof(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	name, _ := wolf.ParamFrom(ctx, "name")
+	name = strings.TrimPrefix(name, "/")
+
+	switch name {
+	case "":
+		pprof.Index(w, r)
+	case "cmdline":
+		pprof.Cmdline(w, r)
+	case "profile":
+		pprof.Profile(w, r)
+	case "symbol":
+		pprof.Symbol(w, r)
+	case "trace":
+		pprof.Trace(w, r)
+	default:
+		pprof.Handler(name).ServeHTTP(w, r)
+	}
+}
+
+func serveGoroutines(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rpprof.Lookup("goroutine").WriteTo(w, 2)
+}
+
+func routesHandler(a *wolf.App) http.HandlerFunc {
+	type route struct {
+		Method     string   `json:"method"`
+		Path       string   `json:"path"`
+		Middleware []string `json:"middleware,omitempty"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		dump := struct {
+			Middleware []string `json:"middleware"`
+			Routes     []route  `json:"routes"`
+		}{
+			Middleware: a.MiddlewareNames(),
+		}
+		for _, rt := range a.Routes() {
+			dump.Routes = append(dump.Routes, route{rt.Method, rt.Path, rt.Middleware})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(dump)
+	}
+}
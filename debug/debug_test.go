@@ -0,0 +1,106 @@
+package debug
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf"
+	"github.com/andrew-d/wolf/wolftest"
+)
+
+func blockingMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "blocked", 418)
+	})
+}
+
+func requireToken(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			http.Error(w, "no", 401)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func TestMount(t *testing.T) {
+	a := wolf.New()
+	a.Use(blockingMiddleware)
+	Mount(a, "/debug/", requireToken)
+	a.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+
+	get := func(path string) *wolftest.Request {
+		return wolftest.NewRequest("GET", path).WithHeader("X-Token", "secret")
+	}
+
+	// Other routes, including ones under the prefix that Mount didn't
+	// register, still go through the App's middleware.
+	get("/").Serve(a).AssertStatus(t, 418)
+	get("/debug/other").Serve(a).AssertStatus(t, 418)
+	wolftest.NewRequest("DELETE", "/debug/vars").Serve(a).AssertStatus(t, 418)
+
+	// The debug routes only go through the auth middleware.
+	wolftest.NewRequest("GET", "/debug/vars").Serve(a).AssertStatus(t, 401)
+	wolftest.NewRequest("GET", "/debug/pprof/heap").WithHeader("X-Token", "wrong").Serve(a).AssertStatus(t, 401)
+
+	resp := get("/debug/vars").Serve(a)
+	resp.AssertStatus(t, 200)
+	resp.AssertBodyContains(t, `"memstats"`)
+
+	resp = get("/debug/pprof/").Serve(a)
+	resp.AssertStatus(t, 200)
+	resp.AssertBodyContains(t, "goroutine")
+
+	resp = get("/debug/pprof/goroutine?debug=1").Serve(a)
+	resp.AssertStatus(t, 200)
+	resp.AssertBodyContains(t, "goroutine profile:")
+
+	get("/debug/pprof/cmdline").Serve(a).AssertStatus(t, 200)
+	get("/debug/pprof/nonexistent").Serve(a).AssertStatus(t, 404)
+
+	resp = get("/debug/goroutines").Serve(a)
+	resp.AssertStatus(t, 200)
+	resp.AssertBodyContains(t, "TestMount")
+}
+
+func TestMountRoutes(t *testing.T) {
+	a := wolf.New()
+	a.Use(func(ctx *context.Context, h http.Handler) http.Handler { return h })
+	a.Use(blockingMiddleware)
+	a.Get("/users/:id", wolf.With(func(w http.ResponseWriter, r *http.Request) {}, requireToken))
+	Mount(a, "/_debug", nil)
+
+	resp := wolftest.NewRequest("GET", "/_debug/routes").Serve(a)
+	resp.AssertStatus(t, 200)
+
+	var dump struct {
+		Middleware []string
+		Routes     []struct {
+			Method, Path string
+			Middleware   []string
+		}
+	}
+	assert.NoError(t, json.Unmarshal(resp.Body, &dump))
+	assert.Equal(t, []string{
+		"github.com/andrew-d/wolf/debug.TestMountRoutes",
+		"github.com/andrew-d/wolf/debug.blockingMiddleware",
+	}, dump.Middleware)
+
+	if assert.True(t, len(dump.Routes) > 1) {
+		assert.Equal(t, "GET", dump.Routes[0].Method)
+		assert.Equal(t, "/users/:id", dump.Routes[0].Path)
+		assert.Equal(t, []string{"github.com/andrew-d/wolf/debug.requireToken"}, dump.Routes[0].Middleware)
+	}
+
+	var paths []string
+	for _, route := range a.Routes() {
+		paths = append(paths, route.Method+" "+route.Path)
+	}
+	assert.Contains(t, strings.Join(paths, "\n"), "GET /_debug/pprof/*name")
+}
@@ -71,19 +71,27 @@ func MakeHandler(h HandlerType) Handler {
 }
 
 // wrapHandler turns something that implements our Handler interface into a
-// function that implements httprouter's interface.
-func (a *App) wrapHandler(v HandlerType) httprouter.Handle {
+// function that implements httprouter's interface.  The pattern is the path
+// that the handler was registered with.
+func (a *App) wrapHandler(pattern string, v HandlerType) httprouter.Handle {
 	h := MakeHandler(v)
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		var ctx context.Context
 
-		// Get context that was modified by the middleware
-		wrapper := r.Body.(*bodyWrapper)
-		ctx = wrapper.ctx
-		r.Body = wrapper.underlying
+		// Get context that was modified by the middleware.  Our wrapper is
+		// put around the body after all middleware has run, so middleware
+		// is free to replace the body.  If we're somehow called without
+		// going through the middleware stack, fall back to the root.
+		if wrapper, ok := r.Body.(*bodyWrapper); ok {
+			ctx = wrapper.ctx
+			r.Body = wrapper.underlying
+		} else {
+			ctx = a.rootContext()
+		}
 
 		// Unpack the request params
 		ctx = setParamsInContext(ctx, p)
+		setRoutePattern(ctx, pattern)
 
 		// TODO: do we want to save w&r in the context?
 
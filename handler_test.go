@@ -109,3 +109,32 @@ func TestOurHandlerStd(t *testing.T) {
 	h.ServeHTTP(w, r)
 	assert.True(t, run)
 }
+
+// Test that middleware can replace the request body.
+func TestMiddlewareReplacesBody(t *testing.T) {
+	a := New()
+	a.Use(func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = ioutil.NopCloser(bytes.NewBufferString("replaced"))
+			h.ServeHTTP(w, r)
+		})
+	})
+
+	var body string
+	a.Post("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		body = string(b)
+	})
+
+	r, err := http.NewRequest("POST", "/", bytes.NewBufferString("original"))
+	assert.NoError(t, err)
+	a.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, "replaced", body)
+
+	// Calling the router directly, without the middleware stack, still works
+	r, err = http.NewRequest("POST", "/", bytes.NewBufferString("direct"))
+	assert.NoError(t, err)
+	a.router.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, "direct", body)
+}
@@ -0,0 +1,266 @@
+// Package health provides liveness and readiness checks for wolf Apps.
+//
+// Liveness checks report whether the process is working at all, and should
+// only fail if it needs restarting.  Readiness checks report whether it can
+// serve traffic right now, e.g. whether its database is reachable:
+//
+//	checker := health.New(health.Options{DrainDelay: 5 * time.Second})
+//	checker.AddReadinessCheck("db", time.Second, func(ctx context.Context) error {
+//		return db.PingContext(ctx)
+//	})
+//	checker.Mount(a)
+//
+// Mount serves /healthz and /readyz, and makes readiness fail as soon as the
+// App begins a graceful shutdown, so that load balancers stop sending it new
+// requests.
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf"
+)
+
+// DefaultTimeout is how long a check may take, if neither it nor
+// Options.Timeout say otherwise.
+const DefaultTimeout = 5 * time.Second
+
+// ErrTimeout is the error reported for checks that don't finish in time.
+var ErrTimeout = errors.New("health: check timed out")
+
+// ErrShuttingDown is the error reported by readiness once a shutdown has
+// begun.
+var ErrShuttingDown = errors.New("health: shutting down")
+
+// CheckFunc checks something, and returns an error if it's unhealthy.  It
+// should give up when ctx is done.
+type CheckFunc func(ctx context.Context) error
+
+// Options controls the behaviour of a Checker.
+type Options struct {
+	// Timeout is how long checks added without a timeout may take.
+	// Defaults to DefaultTimeout.
+	Timeout time.Duration
+
+	// DrainDelay is how long the App waits, once a graceful shutdown has
+	// begun and readiness is failing, before it stops accepting
+	// connections.  Set it to a little more than the interval at which load
+	// balancers check readiness, so that they stop sending requests first.
+	DrainDelay time.Duration
+}
+
+type check struct {
+	name    string
+	timeout time.Duration
+	fn      CheckFunc
+}
+
+// Checker runs a set of named liveness and readiness checks.  Its methods are
+// safe for concurrent use.
+type Checker struct {
+	opts     Options
+	draining int32 // accessed atomically
+
+	mu        sync.Mutex
+	liveness  []check
+	readiness []check
+	names     map[string]bool
+}
+
+// New creates a Checker with no checks.
+func New(opts Options) *Checker {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	return &Checker{opts: opts, names: make(map[string]bool)}
+}
+
+// AddLivenessCheck adds a check that must pass for the process to be
+// considered alive.  If timeout is zero, Options.Timeout is used.  It panics
+// if a check with the same name has already been added.
+func (c *Checker) AddLivenessCheck(name string, timeout time.Duration, fn CheckFunc) {
+	c.add(&c.liveness, name, timeout, fn)
+}
+
+// AddReadinessCheck adds a check that must pass for the process to be
+// considered ready to serve traffic.  If timeout is zero, Options.Timeout is
+// used.  It panics if a check with the same name has already been added.
+func (c *Checker) AddReadinessCheck(name string, timeout time.Duration, fn CheckFunc) {
+	c.add(&c.readiness, name, timeout, fn)
+}
+
+func (c *Checker) add(checks *[]check, name string, timeout time.Duration, fn CheckFunc) {
+	if timeout <= 0 {
+		timeout = c.opts.Timeout
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.names[name] {
+		panic("health: duplicate check " + name)
+	}
+	c.names[name] = true
+	*checks = append(*checks, check{name, timeout, fn})
+}
+
+// Drain makes readiness fail from now on, and then waits for DrainDelay.
+// Mount arranges for it to be called when the App begins a graceful
+// shutdown.
+func (c *Checker) Drain() {
+	atomic.StoreInt32(&c.draining, 1)
+	time.Sleep(c.opts.DrainDelay)
+}
+
+// Mount registers the liveness and readiness handlers on the App as GET
+// /healthz and /readyz, and registers Drain as an OnShutdown function.
+func (c *Checker) Mount(a *wolf.App) {
+	a.Get("/healthz", c.LivenessHandler())
+	a.Get("/readyz", c.ReadinessHandler())
+	a.OnShutdown(c.Drain)
+}
+
+// LivenessHandler returns a handler that runs the liveness checks.
+func (c *Checker) LivenessHandler() wolf.HandlerFunc {
+	return wolf.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		c.mu.Lock()
+		checks := c.liveness
+		c.mu.Unlock()
+
+		writeReport(w, run(ctx, checks))
+	})
+}
+
+// ReadinessHandler returns a handler that runs the readiness checks.  Once
+// Drain has been called, it fails without running them.
+func (c *Checker) ReadinessHandler() wolf.HandlerFunc {
+	return wolf.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&c.draining) != 0 {
+			writeReport(w, &report{
+				Status: statusFailing,
+				Checks: map[string]*result{
+					"shutdown": {Status: statusFailing, Error: ErrShuttingDown.Error()},
+				},
+			})
+			return
+		}
+
+		c.mu.Lock()
+		checks := c.readiness
+		c.mu.Unlock()
+
+		writeReport(w, run(ctx, checks))
+	})
+}
+
+const (
+	statusOK      = "ok"
+	statusFailing = "failing"
+)
+
+// report is the JSON response of the handlers.
+type report struct {
+	Status string             `json:"status"`
+	Checks map[string]*result `json:"checks"`
+}
+
+type result struct {
+	Status   string      `json:"status"`
+	Error    string      `json:"error,omitempty"`
+	Duration json.Number `json:"duration_ms"`
+}
+
+// run runs the checks concurrently, and waits for them to finish or time
+// out.
+func run(ctx context.Context, checks []check) *report {
+	rep := &report{Status: statusOK, Checks: make(map[string]*result, len(checks))}
+	results := make([]*result, len(checks))
+
+	var wg sync.WaitGroup
+	for i, chk := range checks {
+		wg.Add(1)
+		go func(i int, chk check) {
+			defer wg.Done()
+			results[i] = runCheck(ctx, chk)
+		}(i, chk)
+	}
+	wg.Wait()
+
+	for i, chk := range checks {
+		rep.Checks[chk.name] = results[i]
+		if results[i].Status != statusOK {
+			rep.Status = statusFailing
+		}
+	}
+	return rep
+}
+
+// runCheck runs a single check.  Checks that ignore their context are left
+// to finish in the background.  A check that panics fails, rather than taking
+// down the process; the panic is in a goroutine of its own, which nothing
+// else could recover from.
+func runCheck(ctx context.Context, chk check) *result {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, chk.timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- chk.fn(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	// Report failures after the timeout in the same way, whether or not the
+	// check noticed it.
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		err = ErrTimeout
+	}
+
+	res := &result{
+		Status:   statusOK,
+		Duration: json.Number(formatMillis(time.Since(start))),
+	}
+	if err != nil {
+		res.Status = statusFailing
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// The duration is reported in milliseconds, as a decimal.
+func formatMillis(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+func writeReport(w http.ResponseWriter, rep *report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if rep.Status == statusOK {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(rep)
+}
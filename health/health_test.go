@@ -0,0 +1,158 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf"
+)
+
+type testReport struct {
+	Status string
+	Checks map[string]struct {
+		Status string
+		Error  string
+	}
+}
+
+func get(t *testing.T, h http.Handler, path string) (int, testReport) {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", path, nil)
+	h.ServeHTTP(w, r)
+
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var rep testReport
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rep))
+	return w.Code, rep
+}
+
+func ok(ctx context.Context) error { return nil }
+
+func TestChecker(t *testing.T) {
+	c := New(Options{})
+	c.AddLivenessCheck("goroutines", 0, ok)
+	c.AddReadinessCheck("db", 0, ok)
+	c.AddReadinessCheck("cache", 0, func(ctx context.Context) error {
+		return errors.New("connection refused")
+	})
+
+	a := wolf.New()
+	c.Mount(a)
+
+	code, rep := get(t, a, "/healthz")
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "ok", rep.Status)
+	assert.Equal(t, "ok", rep.Checks["goroutines"].Status)
+	assert.Len(t, rep.Checks, 1)
+
+	code, rep = get(t, a, "/readyz")
+	assert.Equal(t, 503, code)
+	assert.Equal(t, "failing", rep.Status)
+	assert.Equal(t, "ok", rep.Checks["db"].Status)
+	assert.Equal(t, "failing", rep.Checks["cache"].Status)
+	assert.Equal(t, "connection refused", rep.Checks["cache"].Error)
+}
+
+// Test that checks run concurrently, and are abandoned when they time out.
+func TestCheckerTimeouts(t *testing.T) {
+	c := New(Options{Timeout: 50 * time.Millisecond})
+	c.AddReadinessCheck("cooperative", 0, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	c.AddReadinessCheck("stubborn", 0, func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	c.AddReadinessCheck("slow", 500*time.Millisecond, func(ctx context.Context) error {
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	})
+
+	start := time.Now()
+	code, rep := get(t, c.ReadinessHandler(), "/")
+	assert.True(t, time.Since(start) < 400*time.Millisecond)
+
+	assert.Equal(t, 503, code)
+	assert.Equal(t, ErrTimeout.Error(), rep.Checks["cooperative"].Error)
+	assert.Equal(t, ErrTimeout.Error(), rep.Checks["stubborn"].Error)
+	assert.Equal(t, "ok", rep.Checks["slow"].Status)
+}
+
+// Test that a panicking check fails instead of crashing the process.
+func TestCheckerPanic(t *testing.T) {
+	c := New(Options{})
+	c.AddReadinessCheck("db", 0, func(ctx context.Context) error {
+		var db *struct{ addr string }
+		return errors.New(db.addr)
+	})
+	c.AddReadinessCheck("cache", 0, func(ctx context.Context) error {
+		panic("no cache")
+	})
+	c.AddReadinessCheck("queue", 0, ok)
+
+	code, rep := get(t, c.ReadinessHandler(), "/")
+	assert.Equal(t, 503, code)
+	assert.Equal(t, "failing", rep.Checks["db"].Status)
+	assert.Contains(t, rep.Checks["db"].Error, "nil pointer dereference")
+	assert.Equal(t, "failing", rep.Checks["cache"].Status)
+	assert.Equal(t, "panic: no cache", rep.Checks["cache"].Error)
+	assert.Equal(t, "ok", rep.Checks["queue"].Status)
+}
+
+func TestCheckerDuplicate(t *testing.T) {
+	c := New(Options{})
+	c.AddLivenessCheck("db", 0, ok)
+	assert.Panics(t, func() {
+		c.AddReadinessCheck("db", 0, ok)
+	})
+}
+
+// Test that readiness fails once a shutdown begins, while the App is still
+// accepting connections.
+func TestCheckerShutdown(t *testing.T) {
+	c := New(Options{DrainDelay: 300 * time.Millisecond})
+	c.AddReadinessCheck("db", 0, ok)
+
+	a := wolf.New()
+	c.Mount(a)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	url := "http://" + l.Addr().String()
+
+	served := make(chan error, 1)
+	go func() {
+		served <- a.Serve(l)
+	}()
+
+	status := func(path string) int {
+		resp, err := http.Get(url + path)
+		if err != nil {
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, 200, status("/readyz"))
+
+	a.Shutdown()
+	deadline := time.Now().Add(200 * time.Millisecond)
+	for status("/readyz") != 503 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 503, status("/readyz"))
+	assert.Equal(t, 200, status("/healthz"))
+
+	assert.NoError(t, <-served)
+}
@@ -0,0 +1,429 @@
+// Package writerproxy implements the http.ResponseWriter wrapper behind
+// middleware.WrapWriter.  It is separate so that packages which middleware
+// imports, such as sessions, can use it too.
+package writerproxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+// Writer is a proxy around a http.ResponseWriter that records information
+// about the response as it is written.  See middleware.WriterProxy.
+type Writer interface {
+	http.ResponseWriter
+	Status() int
+	BytesWritten() int
+	HeadersSent() bool
+	Tee(io.Writer)
+	Unwrap() http.ResponseWriter
+}
+
+// The optional interfaces that a http.ResponseWriter may implement, as bits.
+const (
+	flusher = 1 << iota
+	hijacker
+	closeNotifier
+	readerFrom
+	pusher
+)
+
+// Wrap wraps a http.ResponseWriter in a Writer that implements exactly the
+// optional interfaces that w does, out of http.Flusher, http.Hijacker,
+// http.CloseNotifier, io.ReaderFrom and http.Pusher.
+//
+// If before is not nil, it is called once, just before the response headers
+// are written, while they can still be changed.  Informational (1xx)
+// responses other than 101 Switching Protocols don't count.
+func Wrap(w http.ResponseWriter, before func()) Writer {
+	return wrappers[optional(w)](&basicWriter{ResponseWriter: w, before: before})
+}
+
+// Full is a http.ResponseWriter that implements all of the optional
+// interfaces.
+type Full interface {
+	http.ResponseWriter
+	http.Flusher
+	http.Hijacker
+	http.CloseNotifier
+	io.ReaderFrom
+	http.Pusher
+}
+
+// WrapFull wraps w, a middleware's own writer around underlying, in a Writer
+// that implements exactly the optional interfaces that underlying does.  w
+// has to implement all of them, but its methods are only reachable when
+// underlying has the same one.
+func WrapFull(w Full, underlying http.ResponseWriter) Writer {
+	return wrappers[optional(underlying)](&basicWriter{ResponseWriter: w})
+}
+
+// optional returns the set of optional interfaces that w implements.
+func optional(w http.ResponseWriter) int {
+	var set int
+	if _, ok := w.(http.Flusher); ok {
+		set |= flusher
+	}
+	if _, ok := w.(http.Hijacker); ok {
+		set |= hijacker
+	}
+	if _, ok := w.(http.CloseNotifier); ok {
+		set |= closeNotifier
+	}
+	if _, ok := w.(io.ReaderFrom); ok {
+		set |= readerFrom
+	}
+	if _, ok := w.(http.Pusher); ok {
+		set |= pusher
+	}
+	return set
+}
+
+// basicWriter implements Writer, and none of the optional interfaces.
+type basicWriter struct {
+	http.ResponseWriter
+	before      func()
+	wroteHeader bool
+	code        int
+	bytes       int
+	tee         io.Writer
+}
+
+func (b *basicWriter) WriteHeader(code int) {
+	if !b.wroteHeader && (code >= 200 || code == http.StatusSwitchingProtocols) {
+		if b.before != nil {
+			b.before()
+		}
+		b.code = code
+		b.wroteHeader = true
+	}
+	b.ResponseWriter.WriteHeader(code)
+}
+
+func (b *basicWriter) Write(buf []byte) (int, error) {
+	b.maybeWriteHeader()
+
+	n, err := b.ResponseWriter.Write(buf)
+	if b.tee != nil {
+		_, err2 := b.tee.Write(buf[:n])
+		// Prefer errors generated by the proxied writer.
+		if err == nil {
+			err = err2
+		}
+	}
+	b.bytes += n
+	return n, err
+}
+
+// Writes without a call to WriteHeader send a 200 status implicitly.
+func (b *basicWriter) maybeWriteHeader() {
+	if !b.wroteHeader {
+		b.WriteHeader(http.StatusOK)
+	}
+}
+
+func (b *basicWriter) Status() int {
+	return b.code
+}
+
+func (b *basicWriter) BytesWritten() int {
+	return b.bytes
+}
+
+func (b *basicWriter) HeadersSent() bool {
+	return b.wroteHeader
+}
+
+func (b *basicWriter) Tee(w io.Writer) {
+	b.tee = w
+}
+
+func (b *basicWriter) Unwrap() http.ResponseWriter {
+	return b.ResponseWriter
+}
+
+// Each of these implements one optional interface by forwarding it to the
+// underlying writer.  They're embedded alongside a *basicWriter, so that the
+// combined type has the methods of both.
+
+type flushPart struct{ b *basicWriter }
+
+func (p flushPart) Flush() {
+	p.b.maybeWriteHeader()
+	p.b.ResponseWriter.(http.Flusher).Flush()
+}
+
+type hijackPart struct{ b *basicWriter }
+
+func (p hijackPart) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return p.b.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+type closeNotifyPart struct{ b *basicWriter }
+
+func (p closeNotifyPart) CloseNotify() <-chan bool {
+	return p.b.ResponseWriter.(http.CloseNotifier).CloseNotify()
+}
+
+type readFromPart struct{ b *basicWriter }
+
+func (p readFromPart) ReadFrom(r io.Reader) (int64, error) {
+	// The body has to go through Write if it's being teed.
+	if p.b.tee != nil {
+		return io.Copy(p.b, r)
+	}
+
+	p.b.maybeWriteHeader()
+	n, err := p.b.ResponseWriter.(io.ReaderFrom).ReadFrom(r)
+	p.b.bytes += int(n)
+	return n, err
+}
+
+type pushPart struct{ b *basicWriter }
+
+func (p pushPart) Push(target string, opts *http.PushOptions) error {
+	return p.b.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+// wrappers has a constructor for each combination of optional interfaces,
+// indexed by the set of them.
+var wrappers = [32]func(*basicWriter) Writer{
+	0: func(b *basicWriter) Writer { return b },
+	flusher: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			flushPart
+		}{b, flushPart{b}}
+	},
+	hijacker: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			hijackPart
+		}{b, hijackPart{b}}
+	},
+	flusher | hijacker: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			flushPart
+			hijackPart
+		}{b, flushPart{b}, hijackPart{b}}
+	},
+	closeNotifier: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			closeNotifyPart
+		}{b, closeNotifyPart{b}}
+	},
+	flusher | closeNotifier: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			flushPart
+			closeNotifyPart
+		}{b, flushPart{b}, closeNotifyPart{b}}
+	},
+	hijacker | closeNotifier: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			hijackPart
+			closeNotifyPart
+		}{b, hijackPart{b}, closeNotifyPart{b}}
+	},
+	flusher | hijacker | closeNotifier: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			flushPart
+			hijackPart
+			closeNotifyPart
+		}{b, flushPart{b}, hijackPart{b}, closeNotifyPart{b}}
+	},
+	readerFrom: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			readFromPart
+		}{b, readFromPart{b}}
+	},
+	flusher | readerFrom: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			flushPart
+			readFromPart
+		}{b, flushPart{b}, readFromPart{b}}
+	},
+	hijacker | readerFrom: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			hijackPart
+			readFromPart
+		}{b, hijackPart{b}, readFromPart{b}}
+	},
+	flusher | hijacker | readerFrom: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			flushPart
+			hijackPart
+			readFromPart
+		}{b, flushPart{b}, hijackPart{b}, readFromPart{b}}
+	},
+	closeNotifier | readerFrom: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			closeNotifyPart
+			readFromPart
+		}{b, closeNotifyPart{b}, readFromPart{b}}
+	},
+	flusher | closeNotifier | readerFrom: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			flushPart
+			closeNotifyPart
+			readFromPart
+		}{b, flushPart{b}, closeNotifyPart{b}, readFromPart{b}}
+	},
+	hijacker | closeNotifier | readerFrom: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			hijackPart
+			closeNotifyPart
+			readFromPart
+		}{b, hijackPart{b}, closeNotifyPart{b}, readFromPart{b}}
+	},
+	flusher | hijacker | closeNotifier | readerFrom: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			flushPart
+			hijackPart
+			closeNotifyPart
+			readFromPart
+		}{b, flushPart{b}, hijackPart{b}, closeNotifyPart{b}, readFromPart{b}}
+	},
+	pusher: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			pushPart
+		}{b, pushPart{b}}
+	},
+	flusher | pusher: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			flushPart
+			pushPart
+		}{b, flushPart{b}, pushPart{b}}
+	},
+	hijacker | pusher: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			hijackPart
+			pushPart
+		}{b, hijackPart{b}, pushPart{b}}
+	},
+	flusher | hijacker | pusher: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			flushPart
+			hijackPart
+			pushPart
+		}{b, flushPart{b}, hijackPart{b}, pushPart{b}}
+	},
+	closeNotifier | pusher: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			closeNotifyPart
+			pushPart
+		}{b, closeNotifyPart{b}, pushPart{b}}
+	},
+	flusher | closeNotifier | pusher: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			flushPart
+			closeNotifyPart
+			pushPart
+		}{b, flushPart{b}, closeNotifyPart{b}, pushPart{b}}
+	},
+	hijacker | closeNotifier | pusher: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			hijackPart
+			closeNotifyPart
+			pushPart
+		}{b, hijackPart{b}, closeNotifyPart{b}, pushPart{b}}
+	},
+	flusher | hijacker | closeNotifier | pusher: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			flushPart
+			hijackPart
+			closeNotifyPart
+			pushPart
+		}{b, flushPart{b}, hijackPart{b}, closeNotifyPart{b}, pushPart{b}}
+	},
+	readerFrom | pusher: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			readFromPart
+			pushPart
+		}{b, readFromPart{b}, pushPart{b}}
+	},
+	flusher | readerFrom | pusher: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			flushPart
+			readFromPart
+			pushPart
+		}{b, flushPart{b}, readFromPart{b}, pushPart{b}}
+	},
+	hijacker | readerFrom | pusher: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			hijackPart
+			readFromPart
+			pushPart
+		}{b, hijackPart{b}, readFromPart{b}, pushPart{b}}
+	},
+	flusher | hijacker | readerFrom | pusher: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			flushPart
+			hijackPart
+			readFromPart
+			pushPart
+		}{b, flushPart{b}, hijackPart{b}, readFromPart{b}, pushPart{b}}
+	},
+	closeNotifier | readerFrom | pusher: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			closeNotifyPart
+			readFromPart
+			pushPart
+		}{b, closeNotifyPart{b}, readFromPart{b}, pushPart{b}}
+	},
+	flusher | closeNotifier | readerFrom | pusher: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			flushPart
+			closeNotifyPart
+			readFromPart
+			pushPart
+		}{b, flushPart{b}, closeNotifyPart{b}, readFromPart{b}, pushPart{b}}
+	},
+	hijacker | closeNotifier | readerFrom | pusher: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			hijackPart
+			closeNotifyPart
+			readFromPart
+			pushPart
+		}{b, hijackPart{b}, closeNotifyPart{b}, readFromPart{b}, pushPart{b}}
+	},
+	flusher | hijacker | closeNotifier | readerFrom | pusher: func(b *basicWriter) Writer {
+		return struct {
+			*basicWriter
+			flushPart
+			hijackPart
+			closeNotifyPart
+			readFromPart
+			pushPart
+		}{b, flushPart{b}, hijackPart{b}, closeNotifyPart{b}, readFromPart{b}, pushPart{b}}
+	},
+}
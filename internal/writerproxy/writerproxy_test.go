@@ -0,0 +1,67 @@
+package writerproxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fullWriter implements all of the optional interfaces.
+type fullWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (f fullWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) { return nil, nil, nil }
+func (f fullWriter) CloseNotify() <-chan bool                     { return nil }
+func (f fullWriter) ReadFrom(r io.Reader) (int64, error)          { return io.Copy(f.ResponseRecorder, r) }
+func (f fullWriter) Push(string, *http.PushOptions) error         { return nil }
+
+// Test that every combination of optional interfaces survives wrapping.
+func TestWrapInterfaces(t *testing.T) {
+	for set := range wrappers {
+		// A writer with exactly this set of interfaces.
+		inner := wrappers[set](&basicWriter{ResponseWriter: fullWriter{httptest.NewRecorder()}})
+		assert.Equal(t, set, optional(inner))
+
+		w := Wrap(inner, nil)
+		assert.Equal(t, set, optional(w), "set %05b", set)
+		assert.Equal(t, inner, w.Unwrap())
+	}
+}
+
+// Test that WrapFull hides the methods of the middleware's writer that the
+// underlying writer doesn't have.
+func TestWrapFull(t *testing.T) {
+	for set := range wrappers {
+		underlying := wrappers[set](&basicWriter{ResponseWriter: httptest.NewRecorder()})
+		own := fullWriter{httptest.NewRecorder()}
+
+		w := WrapFull(own, underlying)
+		assert.Equal(t, set, optional(w), "set %05b", set)
+		assert.Equal(t, own, w.Unwrap())
+	}
+}
+
+func TestWrapBefore(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	calls := 0
+	w := Wrap(recorder, func() {
+		calls++
+		recorder.Header().Set("X-Before", "yes")
+	})
+
+	w.WriteHeader(http.StatusEarlyHints)
+	assert.Equal(t, 0, calls)
+	assert.False(t, w.HeadersSent())
+
+	w.Write([]byte("hello"))
+	w.(http.Flusher).Flush()
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, 200, w.Status())
+	assert.Equal(t, "yes", recorder.Header().Get("X-Before"))
+}
@@ -3,7 +3,12 @@ package wolf
 import (
 	"fmt"
 	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 
 	"golang.org/x/net/context"
 )
@@ -23,16 +28,30 @@ type canonicalMiddleware func(ctx *context.Context, h http.Handler) http.Handler
 // pre-built stack instances.
 type middlewareStack struct {
 	funcs []canonicalMiddleware
+	names []string // the names of funcs, for debugging
 	mu    sync.Mutex
 	cache *sync.Pool // cache of pre-built middleware functions
-	app   *App       // the app that this stack belongs to
+	app   *App       // the app that this stack belongs to, if any
+
+	// final is the innermost handler of the stack.  It's given the stack
+	// instance so that it can retrieve the context.
+	final func(s *resolvedStack, w http.ResponseWriter, r *http.Request)
 }
 
 func (m *middlewareStack) Push(fn MiddlewareType) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Typecheck and append this function
+	m.funcs = append(m.funcs, resolveMiddleware(fn))
+	m.names = append(m.names, funcName(fn))
+
+	// Invalidate the existing cache
+	m.resetPool()
+}
+
+// resolveMiddleware typechecks a MiddlewareType and converts it to our
+// canonical type.  It will panic if the input is not a valid MiddlewareType.
+func resolveMiddleware(fn MiddlewareType) canonicalMiddleware {
 	var resolvedFn canonicalMiddleware
 	switch f := fn.(type) {
 	case func(http.Handler) http.Handler:
@@ -48,47 +67,130 @@ func (m *middlewareStack) Push(fn MiddlewareType) {
 		panic(msg)
 	}
 
-	m.funcs = append(m.funcs, resolvedFn)
-
-	// Invalidate the existing cache
-	m.resetPool()
+	return resolvedFn
 }
 
 func (m *middlewareStack) resetPool() {
+	atomic.AddUint64(&poolResets, 1)
 	m.cache = &sync.Pool{
 		New: m.newResolved,
 	}
 }
 
-func (m *middlewareStack) get() http.Handler {
-	return m.cache.Get().(http.Handler)
+func (m *middlewareStack) get() *resolvedStack {
+	return m.cache.Get().(*resolvedStack)
 }
 
-func (m *middlewareStack) release(h http.Handler) {
-	m.cache.Put(h)
+func (m *middlewareStack) release(s *resolvedStack) {
+	// Don't keep the last request alive while in the pool.
+	s.ctx = nil
+	s.wrapper = bodyWrapper{}
+	m.cache.Put(s)
 }
 
-// Apply all middleware funcs to our final routing function
+// resolvedStack is a single instance of a middleware stack.  Every middleware
+// function in it was given a pointer to ctx, which is set to a fresh context
+// before each request.
+type resolvedStack struct {
+	ctx     context.Context
+	handler http.Handler
+	wrapper bodyWrapper
+}
+
+// serve runs a request through this stack with the given context.
+func (s *resolvedStack) serve(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	s.ctx = ctx
+	s.handler.ServeHTTP(w, r)
+}
+
+// Apply all middleware funcs to our final function
 func (m *middlewareStack) newResolved() interface{} {
-	ctx := m.app.RootContext
-	wrapper := bodyWrapper{}
+	atomic.AddUint64(&stacksBuilt, 1)
+
+	s := &resolvedStack{ctx: context.Background()}
+	if m.app != nil {
+		s.ctx = m.app.RootContext
+	}
 
-	// This is the final routing function - it just dispatches to our router
 	var finalFunc http.Handler
 	finalFunc = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Save the context
-		wrapper.ctx = ctx
-		wrapper.underlying = r.Body
-		r.Body = &wrapper
-
-		// Dispatch to router
-		m.app.router.ServeHTTP(w, r)
+		m.final(s, w, r)
 	})
 
 	// Apply middleware
 	for i := len(m.funcs) - 1; i >= 0; i-- {
-		finalFunc = m.funcs[i](&ctx, finalFunc)
+		finalFunc = m.funcs[i](&s.ctx, finalFunc)
+	}
+
+	s.handler = finalFunc
+	return s
+}
+
+// dispatch is the final function of an App's middleware stack - it just
+// dispatches to our router.
+func (a *App) dispatch(s *resolvedStack, w http.ResponseWriter, r *http.Request) {
+	// Save the context
+	s.wrapper.ctx = s.ctx
+	s.wrapper.underlying = r.Body
+	r.Body = &s.wrapper
+
+	// Dispatch to router
+	a.router.ServeHTTP(w, r)
+}
+
+// With returns a Handler that runs the given middleware, in order, around h.
+// This allows middleware to be applied to a single route:
+//
+//	a.Get("/search", wolf.With(search, middleware.Timeout(time.Second)))
+//
+// The middleware's context pointer points to the context the route was
+// called with, so route parameters are available, and any changes are passed
+// on to h.
+func With(h HandlerType, middleware ...MiddlewareType) Handler {
+	handler := MakeHandler(h)
+	stack := &middlewareStack{
+		funcs: make([]canonicalMiddleware, 0, len(middleware)),
+		final: func(s *resolvedStack, w http.ResponseWriter, r *http.Request) {
+			handler.ServeHTTPCtx(s.ctx, w, r)
+		},
+	}
+	for _, m := range middleware {
+		stack.funcs = append(stack.funcs, resolveMiddleware(m))
+		stack.names = append(stack.names, funcName(m))
+	}
+	stack.resetPool()
+
+	if mh, ok := h.(metadataHandler); ok {
+		return metadataHandler{routeStack{stack}, mh.metadata}
 	}
+	return routeStack{stack}
+}
 
-	return finalFunc
+// routeStack is a Handler that runs a middleware stack, as returned by With.
+type routeStack struct {
+	stack *middlewareStack
+}
+
+func (rs routeStack) ServeHTTPCtx(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	s := rs.stack.get()
+	s.serve(ctx, w, r)
+	rs.stack.release(s)
+}
+
+var closureSuffix = regexp.MustCompile(`(\.func\d+)+$`)
+
+// funcName returns the name of a function, for showing to people.  Closures
+// are named after the function that created them, and method values after
+// the method.
+func funcName(fn interface{}) string {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return v.Type().String()
+	}
+	f := runtime.FuncForPC(v.Pointer())
+	if f == nil {
+		return v.Type().String()
+	}
+	name := strings.TrimSuffix(f.Name(), "-fm")
+	return closureSuffix.ReplaceAllString(name, "")
 }
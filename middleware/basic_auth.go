@@ -0,0 +1,206 @@
+package middleware
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/net/context"
+)
+
+var userKey private
+
+// BasicAuth creates a middleware that requires HTTP Basic authentication with
+// one of the given username/password pairs.  Credentials are compared in
+// constant time.  Unauthenticated requests get a HTTP 401 (Unauthorized) with
+// a challenge for the given realm.
+func BasicAuth(realm string, credentials map[string]string) func(*context.Context, http.Handler) http.Handler {
+	type hashedCredential struct {
+		user, password [sha256.Size]byte
+	}
+
+	// Comparing fixed-size hashes stops the lengths of the credentials from
+	// leaking through timing.
+	hashed := make([]hashedCredential, 0, len(credentials))
+	for user, password := range credentials {
+		hashed = append(hashed, hashedCredential{
+			user:     sha256.Sum256([]byte(user)),
+			password: sha256.Sum256([]byte(password)),
+		})
+	}
+
+	validate := func(user, password string) bool {
+		u := sha256.Sum256([]byte(user))
+		p := sha256.Sum256([]byte(password))
+
+		// Check every credential, so that the time taken doesn't depend on
+		// which (if any) matched.
+		match := 0
+		for _, c := range hashed {
+			match |= subtle.ConstantTimeCompare(u[:], c.user[:]) &
+				subtle.ConstantTimeCompare(p[:], c.password[:])
+		}
+		return match == 1
+	}
+
+	return CustomBasicAuth(realm, validate)
+}
+
+// CustomBasicAuth creates a middleware that requires HTTP Basic
+// authentication, as with BasicAuth, but calls validate to check each
+// username and password.  Use an Htpasswd's Validate method to check
+// credentials against a htpasswd file.
+//
+// The authenticated username can be retrieved with GetUser.
+func CustomBasicAuth(realm string, validate func(user, password string) bool) func(*context.Context, http.Handler) http.Handler {
+	challenge := fmt.Sprintf(`Basic realm=%q, charset="UTF-8"`, realm)
+
+	middlewareFunc := func(ctx *context.Context, h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			user, password, ok := r.BasicAuth()
+			if !ok || !validate(user, password) {
+				w.Header().Set("WWW-Authenticate", challenge)
+				http.Error(w, http.StatusText(401), 401)
+				return
+			}
+
+			*ctx = context.WithValue(*ctx, &userKey, user)
+			h.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+
+	return middlewareFunc
+}
+
+// GetUser returns the authenticated username from the given context if one is
+// present.  Returns the empty string if the request was not authenticated.
+func GetUser(ctx context.Context) string {
+	val := ctx.Value(&userKey)
+	if val == nil {
+		return ""
+	}
+	return val.(string)
+}
+
+// htpasswdCheckInterval is how often an Htpasswd checks whether its file has
+// changed.
+const htpasswdCheckInterval = time.Second
+
+// Htpasswd checks credentials against an Apache-style htpasswd file.  The
+// file is reloaded when it changes, so users can be added or removed without
+// restarting the server.
+//
+// Passwords may be hashed with bcrypt ("htpasswd -B") or SHA-1 ("htpasswd
+// -s").  Entries using other schemes, such as Apache's MD5 variant, never
+// match.
+type Htpasswd struct {
+	path string
+
+	mu        sync.Mutex
+	users     map[string]string
+	modTime   time.Time
+	size      int64
+	lastCheck time.Time
+}
+
+// LoadHtpasswd reads the htpasswd file at the given path.
+func LoadHtpasswd(path string) (*Htpasswd, error) {
+	h := &Htpasswd{path: path}
+	if err := h.load(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *Htpasswd) load() error {
+	f, err := os.Open(h.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		users[line[:i]] = line[i+1:]
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	h.users = users
+	h.modTime = fi.ModTime()
+	h.size = fi.Size()
+	return nil
+}
+
+// reload reloads the file if it has changed since it was last loaded.  If it
+// can't be read, the previous contents are kept.
+func (h *Htpasswd) reload() {
+	now := time.Now()
+	if now.Sub(h.lastCheck) < htpasswdCheckInterval {
+		return
+	}
+	h.lastCheck = now
+
+	fi, err := os.Stat(h.path)
+	if err != nil || (fi.ModTime().Equal(h.modTime) && fi.Size() == h.size) {
+		return
+	}
+	h.load()
+}
+
+// dummyHash is checked against the password of unknown users, so that they
+// take as long to reject as known users with the wrong password.  Otherwise
+// the time taken would show which usernames exist.
+const dummyHash = "$2a$10$95AeuxIcK8SoEYmvB4NWkuuKKSpQicQRO/ONDgdQw9PRszuWWwfz2"
+
+// Validate reports whether the given username and password match an entry in
+// the file.  It can be passed to CustomBasicAuth.
+func (h *Htpasswd) Validate(user, password string) bool {
+	h.mu.Lock()
+	h.reload()
+	hash, ok := h.users[user]
+	h.mu.Unlock()
+
+	if !ok {
+		bcrypt.CompareHashAndPassword([]byte(dummyHash), []byte(password))
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		expected := base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(hash[5:]), []byte(expected)) == 1
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf"
+	"github.com/andrew-d/wolf/wolftest"
+)
+
+// basicAuth returns the value of an Authorization header for the given
+// credentials.
+func basicAuth(user, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+}
+
+func helloUser(c context.Context, w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("hello " + GetUser(c)))
+}
+
+func TestBasicAuth(t *testing.T) {
+	a := wolf.New()
+	a.Use(BasicAuth("admin area", map[string]string{
+		"alice": "secret",
+		"bob":   "hunter2",
+	}))
+	a.Get("/", helloUser)
+
+	resp := wolftest.NewRequest("GET", "/").WithHeader("Authorization", basicAuth("alice", "secret")).Serve(a)
+	resp.AssertStatus(t, 200)
+	resp.AssertBody(t, "hello alice")
+
+	resp = wolftest.NewRequest("GET", "/").WithHeader("Authorization", basicAuth("bob", "hunter2")).Serve(a)
+	resp.AssertBody(t, "hello bob")
+
+	for _, creds := range [][2]string{{"alice", "hunter2"}, {"carol", "secret"}} {
+		resp = wolftest.NewRequest("GET", "/").WithHeader("Authorization", basicAuth(creds[0], creds[1])).Serve(a)
+		resp.AssertStatus(t, 401)
+		assert.Equal(t, `Basic realm="admin area", charset="UTF-8"`, resp.Header.Get("WWW-Authenticate"))
+	}
+
+	resp = wolftest.NewRequest("GET", "/").Serve(a)
+	resp.AssertStatus(t, 401)
+	assert.Equal(t, `Basic realm="admin area", charset="UTF-8"`, resp.Header.Get("WWW-Authenticate"))
+}
+
+func TestCustomBasicAuth(t *testing.T) {
+	a := wolf.New()
+	a.Use(CustomBasicAuth("x", func(user, password string) bool {
+		return user == password
+	}))
+	a.Get("/", helloUser)
+
+	wolftest.NewRequest("GET", "/").WithHeader("Authorization", basicAuth("same", "same")).Serve(a).AssertStatus(t, 200)
+	wolftest.NewRequest("GET", "/").WithHeader("Authorization", basicAuth("same", "different")).Serve(a).AssertStatus(t, 401)
+}
+
+func TestGetUserMissing(t *testing.T) {
+	assert.Equal(t, "", GetUser(context.Background()))
+}
+
+func TestHtpasswd(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	contents := "# comment\n" +
+		"alice:" + string(hash) + "\n" +
+		"bob:{SHA}87u9ZqY9S/F0eUBXjsPQEDUw4h0=\n" +
+		"carol:$apr1$abcdefgh$0123456789abcdefghijkl\n"
+	assert.NoError(t, os.WriteFile(path, []byte(contents), 0600))
+
+	h, err := LoadHtpasswd(path)
+	assert.NoError(t, err)
+
+	assert.True(t, h.Validate("alice", "secret"))
+	assert.False(t, h.Validate("alice", "wrong"))
+	assert.True(t, h.Validate("bob", "hunter2"))
+	assert.False(t, h.Validate("bob", "secret"))
+	assert.False(t, h.Validate("carol", "anything"))
+	assert.False(t, h.Validate("dave", ""))
+
+	// Unknown users are checked against a real bcrypt hash, at the default
+	// cost, so that they aren't rejected faster than known ones.
+	cost, err := bcrypt.Cost([]byte(dummyHash))
+	assert.NoError(t, err)
+	assert.Equal(t, bcrypt.DefaultCost, cost)
+
+	// Changes to the file are picked up.
+	assert.NoError(t, os.WriteFile(path, []byte("dave:{SHA}87u9ZqY9S/F0eUBXjsPQEDUw4h0=\n"), 0600))
+	future := time.Now().Add(time.Hour)
+	assert.NoError(t, os.Chtimes(path, future, future))
+	h.lastCheck = time.Time{}
+
+	assert.True(t, h.Validate("dave", "hunter2"))
+	assert.False(t, h.Validate("alice", "secret"))
+
+	// A file that disappears leaves the old entries in place.
+	assert.NoError(t, os.Remove(path))
+	h.lastCheck = time.Time{}
+	assert.True(t, h.Validate("dave", "hunter2"))
+
+	_, err = LoadHtpasswd(path)
+	assert.Error(t, err)
+}
+
+func TestHtpasswdMiddleware(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	assert.NoError(t, os.WriteFile(path, []byte("bob:{SHA}87u9ZqY9S/F0eUBXjsPQEDUw4h0=\n"), 0600))
+	h, err := LoadHtpasswd(path)
+	assert.NoError(t, err)
+
+	a := wolf.New()
+	a.Use(CustomBasicAuth("admin", h.Validate))
+	a.Get("/", helloUser)
+
+	resp := wolftest.NewRequest("GET", "/").WithHeader("Authorization", basicAuth("bob", "hunter2")).Serve(a)
+	resp.AssertStatus(t, 200)
+	resp.AssertBody(t, "hello bob")
+}
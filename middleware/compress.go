@@ -0,0 +1,445 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf/internal/writerproxy"
+)
+
+// DefaultCompressTypes are the content types that Compress compresses if no
+// others are given.
+var DefaultCompressTypes = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/problem+json",
+	"image/svg+xml",
+}
+
+// CompressOptions controls the behaviour of CustomCompress.
+type CompressOptions struct {
+	// Level is the compression level, from flate.BestSpeed to
+	// flate.BestCompression.  Defaults to flate.DefaultCompression.
+	Level int
+
+	// MinSize is the smallest response body, in bytes, that will be
+	// compressed; smaller responses aren't worth the overhead.  Defaults to
+	// 1024.  Responses that are flushed before reaching this size are
+	// compressed regardless, since their final size is unknown.
+	MinSize int
+
+	// ContentTypes lists the media types to compress.  A type may end in
+	// "/*" to match all subtypes.  Defaults to DefaultCompressTypes.
+	ContentTypes []string
+}
+
+// Compress is a middleware that compresses response bodies with gzip or
+// deflate, depending on what the client accepts, using the defaults
+// described in CompressOptions.
+func Compress(ctx *context.Context, h http.Handler) http.Handler {
+	return CustomCompress(CompressOptions{})(ctx, h)
+}
+
+// CustomCompress creates a middleware that compresses responses, as with
+// Compress, with the given options.
+//
+// Responses are not compressed if they already have a Content-Encoding, are
+// partial or bodiless, or have a content type that is not in the allowlist.
+// Requests to upgrade the connection (e.g. WebSockets) are passed through
+// untouched.
+func CustomCompress(opts CompressOptions) func(*context.Context, http.Handler) http.Handler {
+	if opts.Level == 0 {
+		opts.Level = flate.DefaultCompression
+	}
+	if opts.MinSize == 0 {
+		opts.MinSize = 1024
+	}
+	if opts.ContentTypes == nil {
+		opts.ContentTypes = DefaultCompressTypes
+	}
+
+	c := &compressor{
+		opts: opts,
+		gzipPool: sync.Pool{New: func() interface{} {
+			w, _ := gzip.NewWriterLevel(nil, opts.Level)
+			return w
+		}},
+		flatePool: sync.Pool{New: func() interface{} {
+			w, _ := flate.NewWriter(nil, opts.Level)
+			return w
+		}},
+	}
+
+	middlewareFunc := func(ctx *context.Context, h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Upgrade") != "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" {
+				addVary(w.Header(), "Accept-Encoding")
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{
+				ResponseWriter: w,
+				c:              c,
+				encoding:       encoding,
+				head:           r.Method == "HEAD",
+			}
+
+			// This isn't deferred: if the handler panics, we want the
+			// buffered response to be dropped so that a Recoverer further
+			// out can still send an error.
+			h.ServeHTTP(writerproxy.WrapFull(cw, w), r)
+			cw.close()
+		}
+
+		return http.HandlerFunc(fn)
+	}
+
+	return middlewareFunc
+}
+
+// compressor holds the state shared by all requests to a Compress
+// middleware.
+type compressor struct {
+	opts      CompressOptions
+	gzipPool  sync.Pool
+	flatePool sync.Pool
+}
+
+// encoder is implemented by both *gzip.Writer and *flate.Writer.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+func (c *compressor) getEncoder(encoding string, w io.Writer) encoder {
+	var enc encoder
+	if encoding == "gzip" {
+		enc = c.gzipPool.Get().(*gzip.Writer)
+	} else {
+		enc = c.flatePool.Get().(*flate.Writer)
+	}
+	enc.Reset(w)
+	return enc
+}
+
+func (c *compressor) putEncoder(encoding string, enc encoder) {
+	// Don't keep the response writer alive while the encoder is pooled.
+	enc.Reset(ioutil.Discard)
+	if encoding == "gzip" {
+		c.gzipPool.Put(enc)
+	} else {
+		c.flatePool.Put(enc)
+	}
+}
+
+func (c *compressor) allowedType(ctype string) bool {
+	mediaType, _, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		return false
+	}
+
+	for _, allowed := range c.opts.ContentTypes {
+		if strings.HasSuffix(allowed, "/*") {
+			if strings.HasPrefix(mediaType, allowed[:len(allowed)-1]) {
+				return true
+			}
+		} else if mediaType == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateEncoding picks the best encoding that we support from an
+// Accept-Encoding header, preferring gzip when the client has no preference.
+// The empty string is returned if neither is acceptable.
+func negotiateEncoding(header string) string {
+	var gzipQ, deflateQ, starQ float64 = -1, -1, -1
+	for _, part := range strings.Split(header, ",") {
+		name, q := parseQuality(part)
+		switch name {
+		case "gzip", "x-gzip":
+			gzipQ = q
+		case "deflate":
+			deflateQ = q
+		case "*":
+			starQ = q
+		}
+	}
+
+	// A wildcard applies to anything not mentioned explicitly.
+	if gzipQ < 0 {
+		gzipQ = starQ
+	}
+	if deflateQ < 0 {
+		deflateQ = starQ
+	}
+
+	switch {
+	case gzipQ > 0 && gzipQ >= deflateQ:
+		return "gzip"
+	case deflateQ > 0:
+		return "deflate"
+	}
+	return ""
+}
+
+// parseQuality splits an element of an Accept-* header into its (lower-case)
+// value and its quality, which defaults to 1.
+func parseQuality(part string) (string, float64) {
+	name := part
+	q := 1.0
+	if i := strings.Index(part, ";"); i >= 0 {
+		name = part[:i]
+		for _, param := range strings.Split(part[i+1:], ";") {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+	}
+	return strings.ToLower(strings.TrimSpace(name)), q
+}
+
+// addVary adds a value to the Vary header, if it's not there already.
+func addVary(h http.Header, value string) {
+	for _, v := range h["Vary"] {
+		for _, existing := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(existing), value) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", value)
+}
+
+// compressWriter buffers the start of a response until it can decide
+// whether to compress it, and then either compresses or passes through the
+// rest.  It implements all of the optional interfaces, but is wrapped with
+// writerproxy.WrapFull so that handlers only see the ones that the
+// underlying writer has.
+type compressWriter struct {
+	http.ResponseWriter
+	c        *compressor
+	encoding string
+	head     bool
+
+	code        int
+	wroteHeader bool // whether the handler has called WriteHeader
+	decided     bool // whether we've decided whether to compress
+	hijacked    bool
+	buf         []byte
+	enc         encoder
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.code = code
+
+	// Informational responses are sent straight away, and don't count as
+	// the real response.
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		cw.wroteHeader = false
+		cw.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < cw.c.opts.MinSize {
+			return len(p), nil
+		}
+
+		// We've got enough to decide; the buffer now contains p.
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	if cw.enc != nil {
+		return cw.enc.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// decide works out whether to compress the response, sends the headers, and
+// writes out anything that has been buffered.  large is whether the response
+// is known to be at least MinSize bytes long (or of unknown length).
+func (cw *compressWriter) decide(large bool) error {
+	cw.decided = true
+	h := cw.Header()
+
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		// We'd otherwise stop net/http from sniffing this.
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	allowed := cw.c.allowedType(h.Get("Content-Type"))
+	if allowed {
+		addVary(h, "Accept-Encoding")
+	}
+
+	if cl := h.Get("Content-Length"); cl != "" {
+		if n, err := strconv.Atoi(cl); err == nil && n < cw.c.opts.MinSize {
+			large = false
+		}
+	}
+
+	compress := allowed && large &&
+		h.Get("Content-Encoding") == "" &&
+		cw.code != http.StatusNoContent &&
+		cw.code != http.StatusNotModified &&
+		cw.code != http.StatusPartialContent &&
+		!cw.head
+
+	if compress {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+
+		// The compressed body is a different representation, so any strong
+		// validator no longer applies.
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+
+		cw.enc = cw.c.getEncoder(cw.encoding, cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.code)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush implements http.Flusher.  Flushing before the response has reached
+// MinSize means it will be compressed, since its length is then unknown.
+func (cw *compressWriter) Flush() {
+	if cw.hijacked {
+		return
+	}
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		cw.decide(true)
+	}
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker.  Once hijacked, nothing more is written
+// to the response.
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	conn, rw, err := hj.Hijack()
+	if err == nil {
+		cw.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// CloseNotify implements http.CloseNotifier.
+func (cw *compressWriter) CloseNotify() <-chan bool {
+	if cn, ok := cw.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	return make(chan bool)
+}
+
+// ReadFrom implements io.ReaderFrom.  Once the response is known not to be
+// compressed, it uses the underlying writer's ReadFrom, which may be able to
+// send a file without copying it.
+func (cw *compressWriter) ReadFrom(r io.Reader) (int64, error) {
+	if cw.decided && cw.enc == nil {
+		if rf, ok := cw.ResponseWriter.(io.ReaderFrom); ok {
+			return rf.ReadFrom(r)
+		}
+	}
+	// Hide this method from io.Copy, which would otherwise call it.
+	return io.Copy(struct{ io.Writer }{cw}, r)
+}
+
+// Push implements http.Pusher.
+func (cw *compressWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := cw.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// Unwrap allows http.ResponseController to reach the original writer.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// close finishes the response once the handler has returned.
+func (cw *compressWriter) close() {
+	if cw.hijacked {
+		return
+	}
+
+	if !cw.decided {
+		if !cw.wroteHeader {
+			// The handler didn't write anything; leave it to net/http.
+			return
+		}
+		cw.decide(false)
+	}
+
+	if cw.enc != nil {
+		cw.enc.Close()
+		cw.c.putEncoder(cw.encoding, cw.enc)
+		cw.enc = nil
+	}
+}
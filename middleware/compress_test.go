@@ -0,0 +1,179 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/andrew-d/wolf"
+	"github.com/andrew-d/wolf/wolftest"
+)
+
+var bigBody = strings.Repeat("hello world ", 200)
+
+func TestCompress(t *testing.T) {
+	a := wolf.New()
+	a.Use(Compress)
+	a.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("ETag", `"abc"`)
+		w.Write([]byte(bigBody))
+	})
+
+	resp := wolftest.NewRequest("GET", "/").
+		WithHeader("Accept-Encoding", "deflate;q=0.5, gzip").
+		Serve(a)
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+	assert.Equal(t, `W/"abc"`, resp.Header.Get("ETag"))
+	assert.True(t, len(resp.Body) < len(bigBody))
+
+	zr, err := gzip.NewReader(bytes.NewReader(resp.Body))
+	if assert.NoError(t, err) {
+		body, err := ioutil.ReadAll(zr)
+		assert.NoError(t, err)
+		assert.Equal(t, bigBody, string(body))
+	}
+
+	// Deflate, and making sure pooled writers are reset properly
+	for i := 0; i < 2; i++ {
+		resp = wolftest.NewRequest("GET", "/").WithHeader("Accept-Encoding", "deflate").Serve(a)
+		assert.Equal(t, "deflate", resp.Header.Get("Content-Encoding"))
+		body, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(resp.Body)))
+		assert.NoError(t, err)
+		assert.Equal(t, bigBody, string(body))
+	}
+}
+
+func TestCompressSkipped(t *testing.T) {
+	a := wolf.New()
+	a.Use(Compress)
+	a.Get("/big", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(bigBody))
+	})
+	a.Get("/small", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("small"))
+	})
+	a.Get("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte(bigBody))
+	})
+	a.Get("/encoded", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Encoding", "br")
+		w.Write([]byte(bigBody))
+	})
+
+	// Client doesn't accept it
+	resp := wolftest.NewRequest("GET", "/big").Serve(a)
+	assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+	resp.AssertBody(t, bigBody)
+
+	resp = wolftest.NewRequest("GET", "/big").WithHeader("Accept-Encoding", "gzip;q=0, identity").Serve(a)
+	assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+
+	// Too small, the wrong type, or already encoded
+	resp = wolftest.NewRequest("GET", "/small").WithHeader("Accept-Encoding", "gzip").Serve(a)
+	assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+	resp.AssertBody(t, "small")
+
+	resp = wolftest.NewRequest("GET", "/image").WithHeader("Accept-Encoding", "gzip").Serve(a)
+	assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "", resp.Header.Get("Vary"))
+	resp.AssertBody(t, bigBody)
+
+	resp = wolftest.NewRequest("GET", "/encoded").WithHeader("Accept-Encoding", "gzip").Serve(a)
+	assert.Equal(t, "br", resp.Header.Get("Content-Encoding"))
+	resp.AssertBody(t, bigBody)
+}
+
+// Test that flushing works, and flushed responses are compressed.
+func TestCompressFlush(t *testing.T) {
+	a := wolf.New()
+	a.Use(Compress)
+	a.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("first "))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("second"))
+	})
+
+	recorder := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/", nil)
+	assert.NoError(t, err)
+	r.Header.Set("Accept-Encoding", "gzip")
+	a.ServeHTTP(recorder, r)
+
+	assert.True(t, recorder.Flushed)
+	assert.Equal(t, "gzip", recorder.Header().Get("Content-Encoding"))
+
+	zr, err := gzip.NewReader(recorder.Body)
+	if assert.NoError(t, err) {
+		body, _ := ioutil.ReadAll(zr)
+		assert.Equal(t, "first second", string(body))
+	}
+}
+
+// Test that bodies written with ReadFrom are compressed too.
+func TestCompressReadFrom(t *testing.T) {
+	a := wolf.New()
+	a.Use(Compress)
+	a.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.Copy(w, strings.NewReader(bigBody))
+	})
+
+	resp := wolftest.NewRequest("GET", "/").WithHeader("Accept-Encoding", "gzip").Serve(a)
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	zr, err := gzip.NewReader(bytes.NewReader(resp.Body))
+	if assert.NoError(t, err) {
+		body, _ := ioutil.ReadAll(zr)
+		assert.Equal(t, bigBody, string(body))
+	}
+
+	wolftest.NewRequest("GET", "/").Serve(a).AssertBody(t, bigBody)
+}
+
+// Test that the handler's writer only has the optional interfaces of the
+// underlying writer, which for a recorder is just http.Flusher.
+func TestCompressInterfaces(t *testing.T) {
+	a := wolf.New()
+	a.Use(Compress)
+	a.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		_, ok := w.(http.Flusher)
+		assert.True(t, ok)
+		_, ok = w.(http.Hijacker)
+		assert.False(t, ok)
+		_, ok = w.(http.CloseNotifier)
+		assert.False(t, ok)
+		_, ok = w.(io.ReaderFrom)
+		assert.False(t, ok)
+		_, ok = w.(http.Pusher)
+		assert.False(t, ok)
+		w.Write([]byte(bigBody))
+	})
+
+	recorder := httptest.NewRecorder()
+	a.ServeHTTP(recorder, wolftest.NewRequest("GET", "/").WithHeader("Accept-Encoding", "gzip").Build())
+	assert.Equal(t, "gzip", recorder.Header().Get("Content-Encoding"))
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	assert.Equal(t, "gzip", negotiateEncoding("gzip, deflate"))
+	assert.Equal(t, "gzip", negotiateEncoding("*"))
+	assert.Equal(t, "deflate", negotiateEncoding("gzip;q=0.2, deflate"))
+	assert.Equal(t, "deflate", negotiateEncoding("gzip;q=0, *"))
+	assert.Equal(t, "", negotiateEncoding("br, identity"))
+	assert.Equal(t, "", negotiateEncoding(""))
+}
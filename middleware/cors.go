@@ -0,0 +1,234 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf"
+)
+
+// DefaultCORSHeaders are the request headers that CORS allows if no others
+// are given.
+var DefaultCORSHeaders = []string{
+	"Accept",
+	"Accept-Language",
+	"Authorization",
+	"Content-Language",
+	"Content-Type",
+	"X-Requested-With",
+}
+
+// CORSOptions controls the behaviour of the CORS middleware.
+type CORSOptions struct {
+	// AllowedOrigins lists the origins that may make cross-origin requests.
+	// An origin is either an exact match (e.g. "https://example.com"), "*"
+	// to allow any origin, or may contain a single "*" to match any
+	// subdomain (e.g. "https://*.example.com").
+	AllowedOrigins []string
+
+	// AllowOriginFunc, if set, is called for origins that don't match
+	// AllowedOrigins, and the origin is allowed if it returns true.
+	AllowOriginFunc func(origin string) bool
+
+	// AllowedMethods lists the methods that may be used in cross-origin
+	// requests.  If empty, the methods that the App has routes for at the
+	// requested path are allowed.
+	AllowedMethods []string
+
+	// AllowedHeaders lists the request headers that may be sent in
+	// cross-origin requests.  "*" allows any header.  Defaults to
+	// DefaultCORSHeaders.
+	AllowedHeaders []string
+
+	// ExposedHeaders lists the response headers that the browser makes
+	// available to the requesting script.
+	ExposedHeaders []string
+
+	// AllowCredentials allows the browser to send cookies and HTTP
+	// authentication with cross-origin requests.  It can't be combined with
+	// an AllowedOrigins of "*", which would let any site make requests with
+	// the user's credentials and read the responses.
+	AllowCredentials bool
+
+	// MaxAge is how long the browser may cache the result of a preflight
+	// request.  If zero, no Access-Control-Max-Age header is sent.
+	MaxAge time.Duration
+}
+
+// CORS creates a middleware that implements Cross-Origin Resource Sharing
+// with the given options.
+//
+// Preflight requests are answered directly by the middleware for any path
+// that has a route, so there is no need to register OPTIONS routes.  Unless
+// AllowedMethods is set, the methods allowed by a preflight are taken from
+// the App's route table.  Preflight requests for paths without a route are
+// passed on, and will usually get a 404 (Not Found).
+func CORS(opts CORSOptions) func(*context.Context, http.Handler) http.Handler {
+	if opts.AllowedHeaders == nil {
+		opts.AllowedHeaders = DefaultCORSHeaders
+	}
+
+	c := &corsHandler{opts: opts}
+	for _, h := range opts.AllowedHeaders {
+		if h == "*" {
+			c.allowAllHeaders = true
+		}
+	}
+	for _, o := range opts.AllowedOrigins {
+		if o == "*" {
+			c.allowAllOrigins = true
+		}
+	}
+	if c.allowAllOrigins && opts.AllowCredentials {
+		panic(`middleware: CORS can't combine AllowCredentials with an AllowedOrigins of "*"`)
+	}
+
+	middlewareFunc := func(ctx *context.Context, h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
+				if c.preflight(*ctx, w, r, origin) {
+					return
+				}
+			} else {
+				c.actual(w, origin)
+			}
+
+			h.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+
+	return middlewareFunc
+}
+
+type corsHandler struct {
+	opts            CORSOptions
+	allowAllOrigins bool
+	allowAllHeaders bool
+}
+
+// preflight answers a preflight request.  It returns false if the request
+// should be passed on to the router.
+func (c *corsHandler) preflight(ctx context.Context, w http.ResponseWriter, r *http.Request, origin string) bool {
+	hdr := w.Header()
+	addVary(hdr, "Origin")
+	addVary(hdr, "Access-Control-Request-Method")
+	addVary(hdr, "Access-Control-Request-Headers")
+
+	methods := c.opts.AllowedMethods
+	if len(methods) == 0 {
+		methods = wolf.AllowedMethods(ctx, r.URL.Path)
+		if len(methods) == 0 {
+			return false
+		}
+	}
+
+	// A preflight that fails is still answered, but without any CORS
+	// headers, so that the browser blocks the real request.
+	if !c.allowedOrigin(origin) {
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	}
+
+	method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+	if !containsFold(methods, method) {
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	}
+
+	var headers []string
+	for _, h := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		if !c.allowAllHeaders && !containsFold(c.opts.AllowedHeaders, h) {
+			w.WriteHeader(http.StatusNoContent)
+			return true
+		}
+		headers = append(headers, h)
+	}
+
+	c.setOrigin(hdr, origin)
+	hdr.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if len(headers) > 0 {
+		hdr.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+	}
+	if c.opts.MaxAge > 0 {
+		hdr.Set("Access-Control-Max-Age", strconv.Itoa(int(c.opts.MaxAge/time.Second)))
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+// actual adds the CORS headers for a non-preflight request.
+func (c *corsHandler) actual(w http.ResponseWriter, origin string) {
+	hdr := w.Header()
+	addVary(hdr, "Origin")
+
+	if !c.allowedOrigin(origin) {
+		return
+	}
+
+	c.setOrigin(hdr, origin)
+	if len(c.opts.ExposedHeaders) > 0 {
+		hdr.Set("Access-Control-Expose-Headers", strings.Join(c.opts.ExposedHeaders, ", "))
+	}
+}
+
+func (c *corsHandler) setOrigin(hdr http.Header, origin string) {
+	if c.allowAllOrigins {
+		hdr.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		hdr.Set("Access-Control-Allow-Origin", origin)
+	}
+
+	if c.opts.AllowCredentials {
+		hdr.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c *corsHandler) allowedOrigin(origin string) bool {
+	if c.allowAllOrigins {
+		return true
+	}
+
+	lower := strings.ToLower(origin)
+	for _, allowed := range c.opts.AllowedOrigins {
+		allowed = strings.ToLower(allowed)
+		if i := strings.Index(allowed, "*"); i >= 0 {
+			prefix, suffix := allowed[:i], allowed[i+1:]
+			if len(lower) > len(prefix)+len(suffix) &&
+				strings.HasPrefix(lower, prefix) && strings.HasSuffix(lower, suffix) {
+				return true
+			}
+		} else if lower == allowed {
+			return true
+		}
+	}
+
+	if c.opts.AllowOriginFunc != nil {
+		return c.opts.AllowOriginFunc(origin)
+	}
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
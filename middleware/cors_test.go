@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/andrew-d/wolf"
+	"github.com/andrew-d/wolf/wolftest"
+)
+
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+}
+
+// Test that preflights are answered using the route table.
+func TestCORSPreflight(t *testing.T) {
+	a := wolf.New()
+	a.Use(CORS(CORSOptions{
+		AllowedOrigins:   []string{"https://example.com"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}))
+	a.Get("/items/:id", okHandler)
+	a.Delete("/items/:id", okHandler)
+
+	resp := wolftest.NewRequest("OPTIONS", "/items/1").
+		WithHeader("Origin", "https://example.com").
+		WithHeader("Access-Control-Request-Method", "DELETE").
+		WithHeader("Access-Control-Request-Headers", "content-type").
+		Serve(a)
+	resp.AssertStatus(t, 204)
+	assert.Equal(t, "https://example.com", resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, DELETE", resp.Header.Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "content-type", resp.Header.Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "true", resp.Header.Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "600", resp.Header.Get("Access-Control-Max-Age"))
+	assert.Contains(t, resp.Header["Vary"], "Origin")
+
+	// A method without a route
+	resp = wolftest.NewRequest("OPTIONS", "/items/1").
+		WithHeader("Origin", "https://example.com").
+		WithHeader("Access-Control-Request-Method", "PUT").
+		Serve(a)
+	resp.AssertStatus(t, 204)
+	assert.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"))
+
+	// A header that isn't allowed
+	resp = wolftest.NewRequest("OPTIONS", "/items/1").
+		WithHeader("Origin", "https://example.com").
+		WithHeader("Access-Control-Request-Method", "GET").
+		WithHeader("Access-Control-Request-Headers", "X-Secret").
+		Serve(a)
+	assert.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"))
+
+	// A path without any routes
+	resp = wolftest.NewRequest("OPTIONS", "/nope").
+		WithHeader("Origin", "https://example.com").
+		WithHeader("Access-Control-Request-Method", "GET").
+		Serve(a)
+	resp.AssertStatus(t, 404)
+}
+
+func TestCORSOrigins(t *testing.T) {
+	a := wolf.New()
+	a.Use(CORS(CORSOptions{
+		AllowedOrigins: []string{"https://*.example.com"},
+		AllowOriginFunc: func(origin string) bool {
+			return strings.HasSuffix(origin, ".test")
+		},
+		ExposedHeaders: []string{"X-Total"},
+	}))
+	a.Get("/", okHandler)
+
+	for origin, allowed := range map[string]bool{
+		"https://api.example.com":  true,
+		"https://example.com":      false,
+		"https://evilexample.com":  false,
+		"http://api.example.com":   false,
+		"http://localhost.test":    true,
+		"https://example.com.evil": false,
+	} {
+		resp := wolftest.NewRequest("GET", "/").WithHeader("Origin", origin).Serve(a)
+		resp.AssertBody(t, "ok")
+		if allowed {
+			assert.Equal(t, origin, resp.Header.Get("Access-Control-Allow-Origin"), origin)
+			assert.Equal(t, "X-Total", resp.Header.Get("Access-Control-Expose-Headers"))
+		} else {
+			assert.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"), origin)
+		}
+	}
+
+	// Requests that aren't cross-origin are left alone
+	resp := wolftest.NewRequest("GET", "/").Serve(a)
+	assert.Empty(t, resp.Header.Get("Vary"))
+}
+
+func TestCORSWildcard(t *testing.T) {
+	a := wolf.New()
+	a.Use(CORS(CORSOptions{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET"},
+		AllowedHeaders: []string{"*"},
+	}))
+	a.Get("/", okHandler)
+
+	resp := wolftest.NewRequest("OPTIONS", "/").
+		WithHeader("Origin", "https://anywhere.com").
+		WithHeader("Access-Control-Request-Method", "GET").
+		WithHeader("Access-Control-Request-Headers", "X-Anything").
+		Serve(a)
+	assert.Equal(t, "*", resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET", resp.Header.Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "X-Anything", resp.Header.Get("Access-Control-Allow-Headers"))
+}
+
+func TestCORSWildcardCredentials(t *testing.T) {
+	assert.Panics(t, func() {
+		CORS(CORSOptions{AllowedOrigins: []string{"*"}, AllowCredentials: true})
+	})
+	assert.NotPanics(t, func() {
+		CORS(CORSOptions{AllowedOrigins: []string{"https://*.example.com"}, AllowCredentials: true})
+	})
+}
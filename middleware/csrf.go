@@ -0,0 +1,276 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf"
+	"github.com/andrew-d/wolf/sessions"
+)
+
+var csrfKey private
+
+// CSRFExemptKey is the route metadata key that exempts a route from CSRF
+// checks when set to true.  See CSRFExempt.
+const CSRFExemptKey = "csrf.exempt"
+
+// csrfSessionKey is the session key that holds the secret, if
+// CSRFOptions.UseSession is set.
+const csrfSessionKey = "csrf.secret"
+
+// Errors passed to CSRFOptions.OnError when a request is rejected.
+var (
+	ErrCSRFOrigin = errors.New("csrf: request is from another origin")
+	ErrCSRFToken  = errors.New("csrf: missing or invalid token")
+)
+
+// csrfTokenLength is the length of CSRF secrets, in bytes.
+const csrfTokenLength = 32
+
+// CSRFOptions controls the behaviour of the CSRF middleware.
+type CSRFOptions struct {
+	// UseSession stores the CSRF secret in the session, rather than in a
+	// cookie of its own.  The sessions middleware must run before CSRF.
+	UseSession bool
+
+	// CookieName is the name of the cookie that holds the secret, if
+	// UseSession is false.  Defaults to "csrf_token".
+	CookieName string
+
+	// Secure restricts the cookie to HTTPS connections.
+	Secure bool
+
+	// HeaderName is the request header that a token may be sent in.
+	// Defaults to "X-CSRF-Token".
+	HeaderName string
+
+	// FieldName is the form field that a token may be sent in, and the name
+	// used by CSRFField.  Defaults to "csrf_token".
+	FieldName string
+
+	// TrustedOrigins lists other origins (e.g. "https://admin.example.com")
+	// that may make unsafe requests.  Requests from the same host as the
+	// request itself are always allowed.
+	TrustedOrigins []string
+
+	// OnError, if set, is called to write the response when a request is
+	// rejected.  By default a HTTP 403 (Forbidden) is sent.
+	OnError func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// CSRF creates a middleware that protects against cross-site request forgery.
+//
+// Each client is given a secret, stored either in a cookie (the
+// "double-submit cookie" pattern) or in its session.  Requests with unsafe
+// methods (anything but GET, HEAD, OPTIONS and TRACE) must come from the same
+// host, if they have an Origin or Referer header, and must include a token
+// derived from the secret, either in a header or a form field.  Tokens are
+// obtained from the context with CSRFToken or CSRFField.
+//
+// Routes whose handler is wrapped with CSRFExempt are not checked.
+func CSRF(opts CSRFOptions) func(*context.Context, http.Handler) http.Handler {
+	if opts.CookieName == "" {
+		opts.CookieName = "csrf_token"
+	}
+	if opts.HeaderName == "" {
+		opts.HeaderName = "X-CSRF-Token"
+	}
+	if opts.FieldName == "" {
+		opts.FieldName = "csrf_token"
+	}
+	if opts.OnError == nil {
+		opts.OnError = defaultCSRFError
+	}
+
+	middlewareFunc := func(ctx *context.Context, h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			secret := csrfSecret(&opts, *ctx, w, r)
+			*ctx = context.WithValue(*ctx, &csrfKey, &csrfState{
+				secret:    secret,
+				fieldName: opts.FieldName,
+			})
+
+			switch r.Method {
+			case "GET", "HEAD", "OPTIONS", "TRACE":
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			if route, ok := wolf.LookupRoute(*ctx, r.Method, r.URL.Path); ok {
+				if exempt, _ := route.Metadata[CSRFExemptKey].(bool); exempt {
+					h.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			if !csrfSameOrigin(&opts, r) {
+				opts.OnError(w, r, ErrCSRFOrigin)
+				return
+			}
+
+			token := r.Header.Get(opts.HeaderName)
+			if token == "" {
+				token = r.PostFormValue(opts.FieldName)
+			}
+			if !csrfValidToken(secret, token) {
+				opts.OnError(w, r, ErrCSRFToken)
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+
+	return middlewareFunc
+}
+
+// CSRFExempt returns a handler that calls h, with metadata that exempts its
+// routes from CSRF checks.  Use it for endpoints that are authenticated in
+// other ways, such as webhooks.
+func CSRFExempt(h wolf.HandlerType) wolf.Handler {
+	return wolf.WithMetadata(h, map[string]interface{}{CSRFExemptKey: true})
+}
+
+type csrfState struct {
+	secret    []byte
+	fieldName string
+}
+
+// CSRFToken returns a token to include in requests made from the current
+// page, from the given context.  A different token is returned each time,
+// since the secret is masked with random data to prevent BREACH attacks, but
+// all of them are valid.  Returns the empty string if the CSRF middleware was
+// not used.
+func CSRFToken(ctx context.Context) string {
+	st, ok := ctx.Value(&csrfKey).(*csrfState)
+	if !ok {
+		return ""
+	}
+
+	// The token is a random mask followed by the secret XORed with it.
+	token := make([]byte, 2*csrfTokenLength)
+	mask := token[:csrfTokenLength]
+	rand.Read(mask)
+	for i, b := range st.secret {
+		token[csrfTokenLength+i] = b ^ mask[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+// CSRFField returns a hidden form field containing a token, for use in HTML
+// templates:
+//
+//	<form method="POST">{{ .CSRFField }} ... </form>
+func CSRFField(ctx context.Context) template.HTML {
+	st, ok := ctx.Value(&csrfKey).(*csrfState)
+	if !ok {
+		return ""
+	}
+	return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(st.fieldName) +
+		`" value="` + CSRFToken(ctx) + `">`)
+}
+
+// CSRFFuncMap returns template functions for the request with the given
+// context: "csrfToken" returns a token, and "csrfField" a hidden form field
+// containing one.  Add them to a clone of a template before executing it.
+func CSRFFuncMap(ctx context.Context) template.FuncMap {
+	return template.FuncMap{
+		"csrfToken": func() string { return CSRFToken(ctx) },
+		"csrfField": func() template.HTML { return CSRFField(ctx) },
+	}
+}
+
+func defaultCSRFError(w http.ResponseWriter, r *http.Request, err error) {
+	http.Error(w, http.StatusText(403), 403)
+}
+
+// csrfSecret returns the client's secret, creating and storing a new one if
+// it doesn't have one yet.
+func csrfSecret(opts *CSRFOptions, ctx context.Context, w http.ResponseWriter, r *http.Request) []byte {
+	var sess *sessions.Session
+	var stored string
+	if opts.UseSession {
+		sess = sessions.Get(ctx)
+		if sess == nil {
+			panic("middleware: CSRF with UseSession requires the sessions middleware")
+		}
+		stored = sess.GetString(csrfSessionKey)
+	} else if c, err := r.Cookie(opts.CookieName); err == nil {
+		stored = c.Value
+	}
+
+	if secret, err := base64.RawURLEncoding.DecodeString(stored); err == nil && len(secret) == csrfTokenLength {
+		return secret
+	}
+
+	secret := make([]byte, csrfTokenLength)
+	rand.Read(secret)
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+
+	if sess != nil {
+		sess.Set(csrfSessionKey, encoded)
+	} else {
+		http.SetCookie(w, &http.Cookie{
+			Name:     opts.CookieName,
+			Value:    encoded,
+			Path:     "/",
+			Secure:   opts.Secure,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	return secret
+}
+
+func csrfValidToken(secret []byte, token string) bool {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) != 2*csrfTokenLength {
+		return false
+	}
+
+	unmasked := make([]byte, csrfTokenLength)
+	for i := range unmasked {
+		unmasked[i] = raw[csrfTokenLength+i] ^ raw[i]
+	}
+	return subtle.ConstantTimeCompare(unmasked, secret) == 1
+}
+
+// csrfSameOrigin checks the Origin header, or if there isn't one the Referer
+// header, against the request's host and the trusted origins.  Requests with
+// neither are allowed, and left to the token check.
+func csrfSameOrigin(opts *CSRFOptions, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == "null" {
+		ref := r.Header.Get("Referer")
+		if ref == "" {
+			return origin == ""
+		}
+		origin = ref
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	o := u.Scheme + "://" + u.Host
+	for _, trusted := range opts.TrustedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(trusted, "/"), o) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf"
+	"github.com/andrew-d/wolf/sessions"
+	"github.com/andrew-d/wolf/wolftest"
+)
+
+func csrfApp(opts CSRFOptions, mw ...wolf.MiddlewareType) *wolf.App {
+	a := wolf.New()
+	for _, m := range mw {
+		a.Use(m)
+	}
+	a.Use(CSRF(opts))
+
+	a.Get("/token", func(c context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(CSRFToken(c)))
+	})
+	a.Post("/submit", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	a.Post("/webhook", CSRFExempt(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hook"))
+	}))
+	return a
+}
+
+func TestCSRFDoubleSubmit(t *testing.T) {
+	srv := wolftest.NewServer(csrfApp(CSRFOptions{}))
+
+	resp := srv.Do(wolftest.NewRequest("GET", "/token"))
+	token := string(resp.Body)
+	if assert.Len(t, resp.Cookies(), 1) {
+		assert.Equal(t, "csrf_token", resp.Cookies()[0].Name)
+		assert.True(t, resp.Cookies()[0].HttpOnly)
+	}
+
+	// Tokens are different each time, but all valid.
+	token2 := string(srv.Do(wolftest.NewRequest("GET", "/token")).Body)
+	assert.NotEqual(t, token, token2)
+
+	srv.Do(wolftest.NewRequest("POST", "/submit").WithHeader("X-CSRF-Token", token)).AssertBody(t, "ok")
+	srv.Do(wolftest.NewRequest("POST", "/submit").WithForm(url.Values{"csrf_token": {token2}})).AssertBody(t, "ok")
+
+	srv.Do(wolftest.NewRequest("POST", "/submit")).AssertStatus(t, 403)
+	srv.Do(wolftest.NewRequest("POST", "/submit").WithHeader("X-CSRF-Token", "bogus")).AssertStatus(t, 403)
+
+	// A token from another client's secret is no good.
+	other := wolftest.NewServer(csrfApp(CSRFOptions{}))
+	otherToken := string(other.Do(wolftest.NewRequest("GET", "/token")).Body)
+	srv.Do(wolftest.NewRequest("POST", "/submit").WithHeader("X-CSRF-Token", otherToken)).AssertStatus(t, 403)
+
+	// Exempt routes need no token.
+	srv.Do(wolftest.NewRequest("POST", "/webhook")).AssertBody(t, "hook")
+}
+
+func TestCSRFSession(t *testing.T) {
+	var errs []error
+	a := csrfApp(CSRFOptions{
+		UseSession: true,
+		OnError: func(w http.ResponseWriter, r *http.Request, err error) {
+			errs = append(errs, err)
+			http.Error(w, "nope", 400)
+		},
+	}, sessions.Middleware(sessions.Options{Store: sessions.NewMemoryStore()}))
+	srv := wolftest.NewServer(a)
+
+	resp := srv.Do(wolftest.NewRequest("GET", "/token"))
+	token := string(resp.Body)
+	if assert.Len(t, resp.Cookies(), 1) {
+		assert.Equal(t, "session", resp.Cookies()[0].Name)
+	}
+
+	srv.Do(wolftest.NewRequest("POST", "/submit").WithHeader("X-CSRF-Token", token)).AssertBody(t, "ok")
+
+	resp = srv.Do(wolftest.NewRequest("POST", "/submit"))
+	resp.AssertStatus(t, 400)
+	assert.Equal(t, []error{ErrCSRFToken}, errs)
+}
+
+func TestCSRFOrigin(t *testing.T) {
+	srv := wolftest.NewServer(csrfApp(CSRFOptions{
+		TrustedOrigins: []string{"https://admin.example.org"},
+	}))
+	token := string(srv.Do(wolftest.NewRequest("GET", "/token")).Body)
+
+	tests := []struct {
+		header, value string
+		code          int
+	}{
+		{"Origin", "http://example.com", 200},
+		{"Origin", "https://EXAMPLE.com", 200},
+		{"Origin", "https://admin.example.org", 200},
+		{"Origin", "https://evil.example.net", 403},
+		{"Origin", "null", 403},
+		{"Referer", "http://example.com/form", 200},
+		{"Referer", "https://evil.example.net/form", 403},
+	}
+	for _, test := range tests {
+		resp := srv.Do(wolftest.NewRequest("POST", "/submit").
+			WithHeader("X-CSRF-Token", token).
+			WithHeader(test.header, test.value))
+		assert.Equal(t, test.code, resp.Code, "%s: %s", test.header, test.value)
+	}
+}
+
+func TestCSRFTemplate(t *testing.T) {
+	a := wolf.New()
+	a.Use(CSRF(CSRFOptions{FieldName: "_csrf"}))
+
+	tmpl := template.Must(template.New("form").Funcs(CSRFFuncMap(context.Background())).
+		Parse(`<form>{{ csrfField }}</form>`))
+
+	var field, token string
+	a.Get("/", func(c context.Context, w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		t := template.Must(tmpl.Clone())
+		t.Funcs(CSRFFuncMap(c)).Execute(&buf, nil)
+		field = buf.String()
+		token = CSRFToken(c)
+	})
+	wolftest.NewRequest("GET", "/").Serve(a)
+
+	assert.True(t, strings.HasPrefix(field, `<form><input type="hidden" name="_csrf" value="`), field)
+	assert.Len(t, token, 86)
+
+	// Outside of the middleware, there is no token.
+	assert.Equal(t, "", CSRFToken(context.Background()))
+	assert.Equal(t, template.HTML(""), CSRFField(context.Background()))
+}
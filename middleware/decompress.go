@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// DefaultMaxDecompressedSize is the largest decompressed request body that
+// Decompress allows.
+const DefaultMaxDecompressedSize = 10 << 20
+
+// Decompress is a middleware that transparently decodes request bodies sent
+// with a Content-Encoding of gzip or deflate, allowing at most
+// DefaultMaxDecompressedSize bytes once decompressed.
+func Decompress(ctx *context.Context, h http.Handler) http.Handler {
+	return CustomDecompress(DefaultMaxDecompressedSize)(ctx, h)
+}
+
+// CustomDecompress creates a middleware that decodes request bodies, as with
+// Decompress, but allows at most maxSize bytes once decompressed.  This stops
+// a small, highly-compressed body from exhausting the server's memory.
+//
+// Reading beyond maxSize returns a *http.MaxBytesError, and the connection is
+// closed after the response.  Requests with an encoding other than gzip or
+// deflate are answered with a HTTP 415 (Unsupported Media Type), and bodies
+// that are not validly encoded with a HTTP 400 (Bad Request).
+func CustomDecompress(maxSize int64) func(*context.Context, http.Handler) http.Handler {
+	middlewareFunc := func(ctx *context.Context, h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+			if encoding == "" || encoding == "identity" || r.Body == nil || r.Body == http.NoBody {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			body, err := newDecompressReader(encoding, r.Body)
+			if err == errUnsupportedEncoding {
+				http.Error(w, http.StatusText(415), 415)
+				return
+			} else if err != nil {
+				http.Error(w, http.StatusText(400), 400)
+				return
+			}
+
+			// The request now looks as if it was sent uncompressed.
+			r.Body = http.MaxBytesReader(w, body, maxSize)
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+
+			h.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+
+	return middlewareFunc
+}
+
+var errUnsupportedEncoding = errors.New("unsupported Content-Encoding")
+
+// decompressReader decodes a request body, and closes both the decoder and
+// the original body when closed.
+type decompressReader struct {
+	io.Reader
+	decoder io.Closer
+	body    io.Closer
+}
+
+func newDecompressReader(encoding string, body io.ReadCloser) (*decompressReader, error) {
+	var (
+		decoder io.ReadCloser
+		err     error
+	)
+
+	switch encoding {
+	case "gzip", "x-gzip":
+		decoder, err = gzip.NewReader(body)
+	case "deflate":
+		// "deflate" is meant to be zlib-wrapped, but some clients send raw
+		// deflate data, so check for a zlib header.
+		br := bufio.NewReader(body)
+		if hdr, _ := br.Peek(2); len(hdr) == 2 && hdr[0]&0x0f == 8 &&
+			(uint16(hdr[0])<<8|uint16(hdr[1]))%31 == 0 {
+			decoder, err = zlib.NewReader(br)
+		} else {
+			decoder = flate.NewReader(br)
+		}
+	default:
+		return nil, errUnsupportedEncoding
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &decompressReader{
+		Reader:  decoder,
+		decoder: decoder,
+		body:    body,
+	}, nil
+}
+
+func (d *decompressReader) Close() error {
+	d.decoder.Close()
+	return d.body.Close()
+}
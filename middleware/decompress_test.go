@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf"
+)
+
+func compressBody(t *testing.T, encoding, body string) *bytes.Buffer {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "zlib":
+		w = zlib.NewWriter(&buf)
+	case "flate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	}
+	_, err := w.Write([]byte(body))
+	assert.NoError(t, err)
+	w.Close()
+	return &buf
+}
+
+func decompressApp(t *testing.T, maxSize int64) (*wolf.App, *string, *error) {
+	var (
+		body    string
+		readErr error
+	)
+
+	a := wolf.New()
+	a.Use(CustomDecompress(maxSize))
+	a.Post("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Content-Encoding"))
+		b, err := ioutil.ReadAll(r.Body)
+		body, readErr = string(b), err
+	})
+	return a, &body, &readErr
+}
+
+func TestDecompress(t *testing.T) {
+	a, body, readErr := decompressApp(t, DefaultMaxDecompressedSize)
+
+	cases := map[string]string{
+		"gzip":  "gzip",
+		"zlib":  "deflate",
+		"flate": "deflate",
+	}
+	for format, encoding := range cases {
+		r, err := http.NewRequest("POST", "/", compressBody(t, format, "hello world"))
+		assert.NoError(t, err)
+		r.Header.Set("Content-Encoding", encoding)
+
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, r)
+		assert.Equal(t, 200, w.Code, format)
+		assert.NoError(t, *readErr, format)
+		assert.Equal(t, "hello world", *body, format)
+	}
+
+	// Uncompressed bodies are left alone
+	r, err := http.NewRequest("POST", "/", strings.NewReader("plain"))
+	assert.NoError(t, err)
+	a.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, "plain", *body)
+}
+
+func TestDecompressErrors(t *testing.T) {
+	a, _, readErr := decompressApp(t, 100)
+
+	// Too large once decompressed
+	r, err := http.NewRequest("POST", "/", compressBody(t, "gzip", strings.Repeat("a", 1000)))
+	assert.NoError(t, err)
+	r.Header.Set("Content-Encoding", "gzip")
+	a.ServeHTTP(httptest.NewRecorder(), r)
+	if assert.Error(t, *readErr) {
+		_, ok := (*readErr).(*http.MaxBytesError)
+		assert.True(t, ok)
+	}
+
+	// Unsupported encoding
+	r, err = http.NewRequest("POST", "/", strings.NewReader("data"))
+	assert.NoError(t, err)
+	r.Header.Set("Content-Encoding", "br")
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, r)
+	assert.Equal(t, 415, w.Code)
+
+	// Not actually gzipped
+	r, err = http.NewRequest("POST", "/", strings.NewReader("definitely not gzip"))
+	assert.NoError(t, err)
+	r.Header.Set("Content-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	a.ServeHTTP(w, r)
+	assert.Equal(t, 400, w.Code)
+}
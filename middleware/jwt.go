@@ -0,0 +1,430 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+var claimsKey private
+
+// Errors returned when a JWT can't be verified.  They are passed to
+// JWTOptions.OnError.
+var (
+	ErrJWTMissing     = errors.New("jwt: no bearer token")
+	ErrJWTMalformed   = errors.New("jwt: malformed token")
+	ErrJWTAlgorithm   = errors.New("jwt: unsupported algorithm")
+	ErrJWTUnknownKey  = errors.New("jwt: unknown key")
+	ErrJWTSignature   = errors.New("jwt: invalid signature")
+	ErrJWTExpired     = errors.New("jwt: token has expired")
+	ErrJWTNotYetValid = errors.New("jwt: token is not valid yet")
+	ErrJWTAudience    = errors.New("jwt: invalid audience")
+	ErrJWTIssuer      = errors.New("jwt: invalid issuer")
+)
+
+// Claims are the claims of a verified JWT.  The registered claims are parsed
+// into fields; use Decode to get at any others.
+type Claims struct {
+	Issuer    string
+	Subject   string
+	Audience  []string
+	ExpiresAt time.Time
+	NotBefore time.Time
+	IssuedAt  time.Time
+	ID        string
+
+	raw []byte
+}
+
+// Decode unmarshals the token's payload into v, which would usually be a
+// struct with fields for the application's own claims.
+func (c *Claims) Decode(v interface{}) error {
+	return json.Unmarshal(c.raw, v)
+}
+
+// JWTOptions controls the behaviour of the JWT middleware.
+type JWTOptions struct {
+	// Keys maps key IDs (the "kid" header of a token) to the keys that
+	// verify tokens signed with them.  The key stored under "" is used for
+	// tokens without a key ID.  Keys are []byte for HS256, *rsa.PublicKey for
+	// RS256 and *ecdsa.PublicKey for ES256.
+	Keys map[string]interface{}
+
+	// JWKS, if set, is consulted for keys that aren't in Keys.
+	JWKS *JWKS
+
+	// Issuer, if set, must match the token's "iss" claim.
+	Issuer string
+
+	// Audience, if set, must be one of the token's "aud" claims.
+	Audience string
+
+	// Leeway allows for clock skew when checking the "exp" and "nbf"
+	// claims.
+	Leeway time.Duration
+
+	// OnError, if set, is called to write the response when a request's
+	// token is missing or invalid.  By default a HTTP 401 (Unauthorized) is
+	// sent, with a WWW-Authenticate header describing the error.
+	OnError func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// JWT creates a middleware that requires a valid JSON Web Token in the
+// Authorization header of each request, as in "Authorization: Bearer
+// <token>".  Tokens signed with HS256, RS256 or ES256 are supported, and the
+// algorithm must match the type of the key that verifies it.
+//
+// The claims of a verified token can be retrieved with GetClaims.
+func JWT(opts JWTOptions) func(*context.Context, http.Handler) http.Handler {
+	if opts.OnError == nil {
+		opts.OnError = defaultJWTError
+	}
+
+	middlewareFunc := func(ctx *context.Context, h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if !ok {
+				opts.OnError(w, r, ErrJWTMissing)
+				return
+			}
+
+			claims, err := verifyJWT(&opts, token, time.Now())
+			if err != nil {
+				opts.OnError(w, r, err)
+				return
+			}
+
+			*ctx = context.WithValue(*ctx, &claimsKey, claims)
+			h.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+
+	return middlewareFunc
+}
+
+// GetClaims returns the claims of the request's JWT from the given context if
+// present.  Returns nil if the request was not authenticated with a JWT.
+func GetClaims(ctx context.Context) *Claims {
+	val := ctx.Value(&claimsKey)
+	if val == nil {
+		return nil
+	}
+	return val.(*Claims)
+}
+
+func defaultJWTError(w http.ResponseWriter, r *http.Request, err error) {
+	if err == ErrJWTMissing {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	} else {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	}
+	http.Error(w, http.StatusText(401), 401)
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	const prefix = "bearer "
+	if len(auth) <= len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(auth[len(prefix):]), true
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// jwtPayload is used to parse the registered claims.  Dates may be
+// fractional, and the audience may be a single string or an array.
+type jwtPayload struct {
+	Issuer    string          `json:"iss"`
+	Subject   string          `json:"sub"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *float64        `json:"exp"`
+	NotBefore *float64        `json:"nbf"`
+	IssuedAt  *float64        `json:"iat"`
+	ID        string          `json:"jti"`
+}
+
+func verifyJWT(opts *JWTOptions, token string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrJWTMalformed
+	}
+
+	headerJSON, err1 := base64.RawURLEncoding.DecodeString(parts[0])
+	payloadJSON, err2 := base64.RawURLEncoding.DecodeString(parts[1])
+	sig, err3 := base64.RawURLEncoding.DecodeString(parts[2])
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil, ErrJWTMalformed
+	}
+
+	var header jwtHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, ErrJWTMalformed
+	}
+
+	key, ok := opts.Keys[header.KeyID]
+	if !ok && opts.JWKS != nil {
+		key, ok = opts.JWKS.Key(header.KeyID)
+	}
+	if !ok {
+		return nil, ErrJWTUnknownKey
+	}
+
+	signed := token[:len(parts[0])+1+len(parts[1])]
+	if err := verifySignature(header.Algorithm, key, []byte(signed), sig); err != nil {
+		return nil, err
+	}
+
+	var payload jwtPayload
+	if err := json.Unmarshal(payloadJSON, &payload); err != nil {
+		return nil, ErrJWTMalformed
+	}
+
+	claims := &Claims{
+		Issuer:    payload.Issuer,
+		Subject:   payload.Subject,
+		ExpiresAt: numericDate(payload.ExpiresAt),
+		NotBefore: numericDate(payload.NotBefore),
+		IssuedAt:  numericDate(payload.IssuedAt),
+		ID:        payload.ID,
+		raw:       payloadJSON,
+	}
+	if len(payload.Audience) > 0 && json.Unmarshal(payload.Audience, &claims.Audience) != nil {
+		var aud string
+		if json.Unmarshal(payload.Audience, &aud) != nil {
+			return nil, ErrJWTMalformed
+		}
+		claims.Audience = []string{aud}
+	}
+
+	if !claims.ExpiresAt.IsZero() && !now.Before(claims.ExpiresAt.Add(opts.Leeway)) {
+		return nil, ErrJWTExpired
+	}
+	if !claims.NotBefore.IsZero() && now.Add(opts.Leeway).Before(claims.NotBefore) {
+		return nil, ErrJWTNotYetValid
+	}
+	if opts.Issuer != "" && claims.Issuer != opts.Issuer {
+		return nil, ErrJWTIssuer
+	}
+	if opts.Audience != "" {
+		found := false
+		for _, aud := range claims.Audience {
+			if aud == opts.Audience {
+				found = true
+			}
+		}
+		if !found {
+			return nil, ErrJWTAudience
+		}
+	}
+
+	return claims, nil
+}
+
+func numericDate(v *float64) time.Time {
+	if v == nil {
+		return time.Time{}
+	}
+	sec, frac := math.Modf(*v)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
+
+// verifySignature checks a signature with the given algorithm.  The key must
+// be of the right type for the algorithm, so that (for example) a RSA public
+// key can't be used as a HMAC secret.
+func verifySignature(alg string, key interface{}, signed, sig []byte) error {
+	digest := sha256.Sum256(signed)
+
+	switch alg {
+	case "HS256":
+		secret, ok := key.([]byte)
+		if !ok {
+			return ErrJWTAlgorithm
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return ErrJWTSignature
+		}
+
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrJWTAlgorithm
+		}
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) != nil {
+			return ErrJWTSignature
+		}
+
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != elliptic.P256() {
+			return ErrJWTAlgorithm
+		}
+		if len(sig) != 64 {
+			return ErrJWTSignature
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return ErrJWTSignature
+		}
+
+	default:
+		return ErrJWTAlgorithm
+	}
+
+	return nil
+}
+
+// jwksCheckInterval is how often a JWKS checks whether its file has changed.
+const jwksCheckInterval = time.Second
+
+// JWKS is a set of keys loaded from a JSON Web Key Set file.  The file is
+// reloaded when it changes, so keys can be rotated without restarting the
+// server.  RSA, P-256 EC and symmetric ("oct") keys are supported; others
+// are ignored.
+type JWKS struct {
+	path string
+
+	mu        sync.Mutex
+	keys      map[string]interface{}
+	modTime   time.Time
+	size      int64
+	lastCheck time.Time
+}
+
+// LoadJWKS reads the JWKS file at the given path.
+func LoadJWKS(path string) (*JWKS, error) {
+	j := &JWKS{path: path}
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+	K       string `json:"k"`
+}
+
+func (j *JWKS) load() error {
+	data, err := os.ReadFile(j.path)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(j.path)
+	if err != nil {
+		return err
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]interface{})
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key := jwk.publicKey(); key != nil {
+			keys[jwk.KeyID] = key
+		}
+	}
+
+	j.keys = keys
+	j.modTime = fi.ModTime()
+	j.size = fi.Size()
+	return nil
+}
+
+// publicKey returns the key described by a JWK, or nil if it isn't valid or
+// supported.
+func (jwk *jsonWebKey) publicKey() interface{} {
+	switch jwk.KeyType {
+	case "RSA":
+		n, err1 := base64.RawURLEncoding.DecodeString(jwk.N)
+		e, err2 := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err1 != nil || err2 != nil || len(e) > 4 {
+			return nil
+		}
+		exp := new(big.Int).SetBytes(e)
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}
+
+	case "EC":
+		if jwk.Curve != "P-256" {
+			return nil
+		}
+		x, err1 := base64.RawURLEncoding.DecodeString(jwk.X)
+		y, err2 := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err1 != nil || err2 != nil {
+			return nil
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil
+		}
+		return pub
+
+	case "oct":
+		k, err := base64.RawURLEncoding.DecodeString(jwk.K)
+		if err != nil {
+			return nil
+		}
+		return k
+	}
+	return nil
+}
+
+// Key returns the key with the given ID, reloading the file first if it has
+// changed.  If the file can't be read, the previous keys are kept.
+func (j *JWKS) Key(kid string) (interface{}, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(j.lastCheck) >= jwksCheckInterval {
+		j.lastCheck = now
+		fi, err := os.Stat(j.path)
+		if err == nil && (!fi.ModTime().Equal(j.modTime) || fi.Size() != j.size) {
+			j.load()
+		}
+	}
+
+	key, ok := j.keys[kid]
+	return key, ok
+}
@@ -0,0 +1,237 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf"
+	"github.com/andrew-d/wolf/wolftest"
+)
+
+var b64 = base64.RawURLEncoding
+
+// signJWT creates a token with the given header and claims, signed with key.
+func signJWT(t *testing.T, header, claims map[string]interface{}, key interface{}) string {
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	signed := b64.EncodeToString(h) + "." + b64.EncodeToString(c)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		assert.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		assert.NoError(t, err)
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return signed + "." + b64.EncodeToString(sig)
+}
+
+func writeSubject(c context.Context, w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(GetClaims(c).Subject))
+}
+
+func TestJWTAlgorithms(t *testing.T) {
+	secret := []byte("secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	a := wolf.New()
+	a.Use(JWT(JWTOptions{Keys: map[string]interface{}{
+		"":    secret,
+		"rsa": &rsaKey.PublicKey,
+		"ec":  &ecKey.PublicKey,
+	}}))
+	a.Get("/", writeSubject)
+
+	claims := map[string]interface{}{"sub": "alice"}
+	tokens := []string{
+		signJWT(t, map[string]interface{}{"alg": "HS256"}, claims, secret),
+		signJWT(t, map[string]interface{}{"alg": "RS256", "kid": "rsa"}, claims, rsaKey),
+		signJWT(t, map[string]interface{}{"alg": "ES256", "kid": "ec"}, claims, ecKey),
+	}
+	for _, token := range tokens {
+		resp := wolftest.NewRequest("GET", "/").WithHeader("Authorization", "Bearer "+token).Serve(a)
+		resp.AssertStatus(t, 200)
+		resp.AssertBody(t, "alice")
+	}
+
+	// The algorithm must match the key.
+	forged := signJWT(t, map[string]interface{}{"alg": "HS256", "kid": "rsa"}, claims, secret)
+	wolftest.NewRequest("GET", "/").WithHeader("Authorization", "Bearer "+forged).Serve(a).AssertStatus(t, 401)
+	none := signJWT(t, map[string]interface{}{"alg": "none"}, claims, nil)
+	wolftest.NewRequest("GET", "/").WithHeader("Authorization", "Bearer "+none).Serve(a).AssertStatus(t, 401)
+
+	// Tampering with the payload breaks the signature.
+	parts := strings.Split(tokens[0], ".")
+	parts[1] = b64.EncodeToString([]byte(`{"sub":"mallory"}`))
+	resp := wolftest.NewRequest("GET", "/").WithHeader("Authorization", "Bearer "+strings.Join(parts, ".")).Serve(a)
+	resp.AssertStatus(t, 401)
+	assert.Equal(t, `Bearer error="invalid_token"`, resp.Header.Get("WWW-Authenticate"))
+
+	resp = wolftest.NewRequest("GET", "/").Serve(a)
+	resp.AssertStatus(t, 401)
+	assert.Equal(t, "Bearer", resp.Header.Get("WWW-Authenticate"))
+}
+
+func TestJWTClaims(t *testing.T) {
+	secret := []byte("secret")
+	opts := &JWTOptions{
+		Keys:     map[string]interface{}{"": secret},
+		Issuer:   "https://issuer.example.com",
+		Audience: "api",
+		Leeway:   time.Minute,
+	}
+	header := map[string]interface{}{"alg": "HS256"}
+	now := time.Unix(1500000000, 0)
+
+	tests := []struct {
+		claims map[string]interface{}
+		err    error
+	}{
+		{map[string]interface{}{"iss": opts.Issuer, "aud": "api", "exp": 1500000030}, nil},
+		{map[string]interface{}{"iss": opts.Issuer, "aud": []string{"web", "api"}}, nil},
+		{map[string]interface{}{"iss": opts.Issuer, "aud": "api", "exp": 1499999930}, ErrJWTExpired},
+		{map[string]interface{}{"iss": opts.Issuer, "aud": "api", "nbf": 1500000030}, nil},
+		{map[string]interface{}{"iss": opts.Issuer, "aud": "api", "nbf": 1500000090}, ErrJWTNotYetValid},
+		{map[string]interface{}{"iss": "other", "aud": "api"}, ErrJWTIssuer},
+		{map[string]interface{}{"iss": opts.Issuer, "aud": "web"}, ErrJWTAudience},
+		{map[string]interface{}{"iss": opts.Issuer}, ErrJWTAudience},
+	}
+	for i, test := range tests {
+		_, err := verifyJWT(opts, signJWT(t, header, test.claims, secret), now)
+		assert.Equal(t, test.err, err, "test %d", i)
+	}
+
+	_, err := verifyJWT(opts, "not.a.jwt", now)
+	assert.Equal(t, ErrJWTMalformed, err)
+	_, err = verifyJWT(opts, signJWT(t, map[string]interface{}{"alg": "HS256", "kid": "x"}, nil, secret), now)
+	assert.Equal(t, ErrJWTUnknownKey, err)
+
+	// Registered claims are parsed, and others can be decoded.
+	token := signJWT(t, header, map[string]interface{}{
+		"iss":   opts.Issuer,
+		"sub":   "alice",
+		"aud":   "api",
+		"iat":   1499999999.5,
+		"jti":   "abc",
+		"admin": true,
+	}, secret)
+	claims, err := verifyJWT(opts, token, now)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "alice", claims.Subject)
+		assert.Equal(t, []string{"api"}, claims.Audience)
+		assert.Equal(t, time.Unix(1499999999, 5e8), claims.IssuedAt)
+		assert.Equal(t, "abc", claims.ID)
+
+		var custom struct {
+			Admin bool `json:"admin"`
+		}
+		assert.NoError(t, claims.Decode(&custom))
+		assert.True(t, custom.Admin)
+	}
+}
+
+func TestJWTOnError(t *testing.T) {
+	a := wolf.New()
+	a.Use(JWT(JWTOptions{
+		Keys: map[string]interface{}{"": []byte("secret")},
+		OnError: func(w http.ResponseWriter, r *http.Request, err error) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(403)
+			fmt.Fprintf(w, `{"error":%q}`, err.Error())
+		},
+	}))
+	a.Get("/", writeSubject)
+
+	resp := wolftest.NewRequest("GET", "/").Serve(a)
+	resp.AssertStatus(t, 403)
+	resp.AssertBody(t, `{"error":"jwt: no bearer token"}`)
+}
+
+func TestGetClaimsMissing(t *testing.T) {
+	assert.Nil(t, GetClaims(context.Background()))
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS := func(keys ...map[string]string) {
+		data, _ := json.Marshal(map[string]interface{}{"keys": keys})
+		assert.NoError(t, os.WriteFile(path, data, 0600))
+	}
+	writeJWKS(
+		map[string]string{
+			"kty": "RSA",
+			"kid": "rsa",
+			"n":   b64.EncodeToString(rsaKey.N.Bytes()),
+			"e":   b64.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+		},
+		map[string]string{
+			"kty": "EC",
+			"kid": "ec",
+			"crv": "P-256",
+			"x":   b64.EncodeToString(ecKey.X.Bytes()),
+			"y":   b64.EncodeToString(ecKey.Y.Bytes()),
+		},
+		map[string]string{"kty": "oct", "kid": "enc", "use": "enc", "k": "c2VjcmV0"},
+	)
+
+	jwks, err := LoadJWKS(path)
+	assert.NoError(t, err)
+	_, ok := jwks.Key("enc")
+	assert.False(t, ok)
+
+	a := wolf.New()
+	a.Use(JWT(JWTOptions{JWKS: jwks}))
+	a.Get("/", writeSubject)
+	claims := map[string]interface{}{"sub": "bob"}
+	rsaToken := signJWT(t, map[string]interface{}{"alg": "RS256", "kid": "rsa"}, claims, rsaKey)
+	ecToken := signJWT(t, map[string]interface{}{"alg": "ES256", "kid": "ec"}, claims, ecKey)
+	wolftest.NewRequest("GET", "/").WithHeader("Authorization", "Bearer "+rsaToken).Serve(a).AssertStatus(t, 200)
+	wolftest.NewRequest("GET", "/").WithHeader("Authorization", "Bearer "+ecToken).Serve(a).AssertStatus(t, 200)
+
+	// Rotating the keys takes effect without reloading by hand.
+	writeJWKS(map[string]string{"kty": "oct", "kid": "hs", "k": "c2VjcmV0"})
+	future := time.Now().Add(time.Hour)
+	assert.NoError(t, os.Chtimes(path, future, future))
+	jwks.lastCheck = time.Time{}
+
+	wolftest.NewRequest("GET", "/").WithHeader("Authorization", "Bearer "+rsaToken).Serve(a).AssertStatus(t, 401)
+	hsToken := signJWT(t, map[string]interface{}{"alg": "HS256", "kid": "hs"}, claims, []byte("secret"))
+	wolftest.NewRequest("GET", "/").WithHeader("Authorization", "Bearer "+hsToken).Serve(a).AssertStatus(t, 200)
+}
@@ -0,0 +1,231 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf"
+)
+
+// LogEntry contains information about a single request, as logged by Logger.
+type LogEntry struct {
+	// Time is when the request started.
+	Time time.Time
+
+	// RequestID is the ID of this request.  It may be empty if the
+	// RequestID middleware was not included.
+	RequestID string
+
+	Method string
+	Path   string
+
+	// Route is the pattern of the route that handled the request, or the
+	// empty string if no route matched.
+	Route string
+
+	Status  int
+	Bytes   int
+	Latency time.Duration
+
+	// RemoteAddr is the client's IP address if the RealIP middleware was
+	// used, or the request's RemoteAddr otherwise.
+	RemoteAddr string
+}
+
+// LogFormat is the format that a WriterSink writes log lines in.
+type LogFormat int
+
+const (
+	// LogfmtFormat writes lines of space-separated key=value pairs.
+	LogfmtFormat LogFormat = iota
+
+	// JSONFormat writes each line as a JSON object.
+	JSONFormat
+)
+
+// LogSink receives log entries from a Logger.  Log may be called
+// concurrently from multiple goroutines.
+type LogSink interface {
+	Log(entry *LogEntry)
+}
+
+// LoggerOptions controls the behaviour of CustomLogger.
+type LoggerOptions struct {
+	// Sink receives every log entry.  Defaults to a logfmt WriterSink
+	// writing to os.Stderr.
+	Sink LogSink
+
+	// Sample, if set, is called with each entry and the entry is only
+	// logged if it returns true.  See SampleRate.
+	Sample func(entry *LogEntry) bool
+}
+
+// Logger is a middleware that writes a line to os.Stderr in logfmt format for
+// each request, containing the request ID, method, route pattern, status,
+// response size, latency and remote address.
+func Logger(ctx *context.Context, h http.Handler) http.Handler {
+	return CustomLogger(LoggerOptions{})(ctx, h)
+}
+
+// CustomLogger creates a middleware that logs each request, as with Logger,
+// but allows configuring where the logs are sent and which requests are
+// logged.
+func CustomLogger(opts LoggerOptions) func(*context.Context, http.Handler) http.Handler {
+	sink := opts.Sink
+	if sink == nil {
+		sink = NewWriterSink(os.Stderr, LogfmtFormat)
+	}
+
+	middlewareFunc := func(ctx *context.Context, h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			lw := WrapWriter(w)
+
+			h.ServeHTTP(lw, r)
+
+			status := lw.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			entry := &LogEntry{
+				Time:       start,
+				RequestID:  GetReqID(*ctx),
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				Route:      wolf.RoutePattern(*ctx),
+				Status:     status,
+				Bytes:      lw.BytesWritten(),
+				Latency:    time.Since(start),
+				RemoteAddr: r.RemoteAddr,
+			}
+			if ip := ClientIP(*ctx); ip != "" {
+				entry.RemoteAddr = ip
+			}
+			if opts.Sample != nil && !opts.Sample(entry) {
+				return
+			}
+			sink.Log(entry)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+
+	return middlewareFunc
+}
+
+// SampleRate returns a function for LoggerOptions.Sample that logs the given
+// fraction of requests, chosen at random.  Requests that resulted in a server
+// error (status 500 and above) are always logged.
+func SampleRate(rate float64) func(*LogEntry) bool {
+	return func(entry *LogEntry) bool {
+		return entry.Status >= 500 || rand.Float64() < rate
+	}
+}
+
+// WriterSink is a LogSink that writes each entry as a line to an io.Writer.
+type WriterSink struct {
+	format LogFormat
+
+	mu  sync.Mutex
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+// NewWriterSink creates a WriterSink that writes to w in the given format.
+func NewWriterSink(w io.Writer, format LogFormat) *WriterSink {
+	return &WriterSink{w: w, format: format}
+}
+
+// Log implements LogSink.
+func (s *WriterSink) Log(entry *LogEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buf.Reset()
+	if s.format == JSONFormat {
+		writeJSONEntry(&s.buf, entry)
+	} else {
+		writeLogfmtEntry(&s.buf, entry)
+	}
+	s.buf.WriteByte('\n')
+	s.w.Write(s.buf.Bytes())
+}
+
+// The latency is logged in milliseconds, as a decimal.
+func latencyMillis(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+func writeJSONEntry(buf *bytes.Buffer, e *LogEntry) {
+	// Encoding a map would sort the keys; a struct keeps them in a sensible
+	// order.
+	json.NewEncoder(buf).Encode(struct {
+		Time       string      `json:"time"`
+		RequestID  string      `json:"request_id,omitempty"`
+		Method     string      `json:"method"`
+		Path       string      `json:"path"`
+		Route      string      `json:"route,omitempty"`
+		Status     int         `json:"status"`
+		Bytes      int         `json:"bytes"`
+		Latency    json.Number `json:"latency_ms"`
+		RemoteAddr string      `json:"remote_addr"`
+	}{
+		Time:       e.Time.UTC().Format(time.RFC3339Nano),
+		RequestID:  e.RequestID,
+		Method:     e.Method,
+		Path:       e.Path,
+		Route:      e.Route,
+		Status:     e.Status,
+		Bytes:      e.Bytes,
+		Latency:    json.Number(latencyMillis(e.Latency)),
+		RemoteAddr: e.RemoteAddr,
+	})
+
+	// Encode adds its own newline
+	buf.Truncate(buf.Len() - 1)
+}
+
+func writeLogfmtEntry(buf *bytes.Buffer, e *LogEntry) {
+	writeLogfmtPair(buf, "time", e.Time.UTC().Format(time.RFC3339Nano))
+	if e.RequestID != "" {
+		writeLogfmtPair(buf, "request_id", e.RequestID)
+	}
+	writeLogfmtPair(buf, "method", e.Method)
+	writeLogfmtPair(buf, "path", e.Path)
+	if e.Route != "" {
+		writeLogfmtPair(buf, "route", e.Route)
+	}
+	writeLogfmtPair(buf, "status", strconv.Itoa(e.Status))
+	writeLogfmtPair(buf, "bytes", strconv.Itoa(e.Bytes))
+	writeLogfmtPair(buf, "latency_ms", latencyMillis(e.Latency))
+	writeLogfmtPair(buf, "remote_addr", e.RemoteAddr)
+}
+
+func writeLogfmtPair(buf *bytes.Buffer, key, value string) {
+	if buf.Len() > 0 {
+		buf.WriteByte(' ')
+	}
+	buf.WriteString(key)
+	buf.WriteByte('=')
+
+	if value == "" || strings.ContainsAny(value, " =\"\\") || strings.IndexFunc(value, isControl) >= 0 {
+		buf.WriteString(strconv.Quote(value))
+	} else {
+		buf.WriteString(value)
+	}
+}
+
+func isControl(r rune) bool {
+	return r < ' ' || r == 0x7f
+}
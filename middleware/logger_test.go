@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf"
+)
+
+type memorySink struct {
+	entries []*LogEntry
+}
+
+func (m *memorySink) Log(entry *LogEntry) {
+	m.entries = append(m.entries, entry)
+}
+
+// Test that the logger records the details of a request.
+func TestLogger(t *testing.T) {
+	sink := &memorySink{}
+
+	a := wolf.New()
+	a.Use(RequestID)
+	a.Use(CustomLogger(LoggerOptions{Sink: sink}))
+	a.Get("/users/:id", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(201)
+		w.Write([]byte("hello"))
+	})
+
+	r, err := http.NewRequest("GET", "/users/42", nil)
+	assert.NoError(t, err)
+	r.RemoteAddr = "10.0.0.1:1234"
+	a.ServeHTTP(httptest.NewRecorder(), r)
+
+	r, err = http.NewRequest("GET", "/nope", nil)
+	assert.NoError(t, err)
+	a.ServeHTTP(httptest.NewRecorder(), r)
+
+	if !assert.Len(t, sink.entries, 2) {
+		return
+	}
+
+	e := sink.entries[0]
+	assert.NotEmpty(t, e.RequestID)
+	assert.Equal(t, "GET", e.Method)
+	assert.Equal(t, "/users/42", e.Path)
+	assert.Equal(t, "/users/:id", e.Route)
+	assert.Equal(t, 201, e.Status)
+	assert.Equal(t, 5, e.Bytes)
+	assert.Equal(t, "10.0.0.1:1234", e.RemoteAddr)
+
+	e = sink.entries[1]
+	assert.Equal(t, 404, e.Status)
+	assert.Equal(t, "", e.Route)
+}
+
+func TestLoggerSample(t *testing.T) {
+	sink := &memorySink{}
+
+	a := wolf.New()
+	a.Use(CustomLogger(LoggerOptions{Sink: sink, Sample: SampleRate(0)}))
+	a.Get("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	a.Get("/fail", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+	})
+
+	for _, path := range []string{"/ok", "/fail", "/ok"} {
+		r, err := http.NewRequest("GET", path, nil)
+		assert.NoError(t, err)
+		a.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	// Only the error is always logged
+	if assert.Len(t, sink.entries, 1) {
+		assert.Equal(t, 500, sink.entries[0].Status)
+	}
+}
+
+func TestWriterSink(t *testing.T) {
+	entry := &LogEntry{
+		Time:       time.Date(2015, 7, 1, 12, 0, 0, 0, time.UTC),
+		RequestID:  "host/abc-000001",
+		Method:     "GET",
+		Path:       "/a path",
+		Route:      "/:name",
+		Status:     200,
+		Bytes:      12,
+		Latency:    1500 * time.Microsecond,
+		RemoteAddr: "10.0.0.1:1234",
+	}
+
+	var buf bytes.Buffer
+	NewWriterSink(&buf, LogfmtFormat).Log(entry)
+	assert.Equal(t, `time=2015-07-01T12:00:00Z request_id=host/abc-000001 `+
+		`method=GET path="/a path" route=/:name status=200 bytes=12 `+
+		`latency_ms=1.500 remote_addr=10.0.0.1:1234`+"\n", buf.String())
+
+	buf.Reset()
+	NewWriterSink(&buf, JSONFormat).Log(entry)
+	assert.True(t, strings.HasSuffix(buf.String(), "}\n"))
+
+	var decoded map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, "host/abc-000001", decoded["request_id"])
+	assert.Equal(t, "/:name", decoded["route"])
+	assert.Equal(t, 200.0, decoded["status"])
+	assert.Equal(t, 1.5, decoded["latency_ms"])
+}
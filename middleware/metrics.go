@@ -0,0 +1,294 @@
+package middleware
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf"
+)
+
+// DefaultDurationBuckets are the upper bounds, in seconds, of the request
+// latency histogram buckets, unless MetricsOptions.DurationBuckets says
+// otherwise.
+var DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultSizeBuckets are the upper bounds, in bytes, of the response size
+// histogram buckets, unless MetricsOptions.SizeBuckets says otherwise.
+var DefaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1e6, 1e7}
+
+// MetricsOptions controls the behaviour of a Metrics.
+type MetricsOptions struct {
+	// DurationBuckets are the upper bounds of the latency histogram's
+	// buckets, in seconds and in increasing order.  Defaults to
+	// DefaultDurationBuckets.
+	DurationBuckets []float64
+
+	// SizeBuckets are the upper bounds of the response size histogram's
+	// buckets, in bytes and in increasing order.  Defaults to
+	// DefaultSizeBuckets.
+	SizeBuckets []float64
+}
+
+// Metrics collects metrics about requests, and serves them in the Prometheus
+// text exposition format.  Add its Middleware method to an App, and register
+// the Metrics itself as the handler that Prometheus scrapes:
+//
+//	metrics := middleware.NewMetrics(middleware.MetricsOptions{})
+//	a.Use(metrics.Middleware)
+//	a.Get("/metrics", metrics)
+//
+// Requests are counted, and their latency and response size recorded, by
+// method, route pattern and status class (e.g. "2xx"), so that the number of
+// series doesn't grow with the number of distinct URLs.  Requests that don't
+// match a route have an empty route label.  The number of requests in flight
+// is tracked by method and route pattern.  wolf's internal counters (see
+// wolf.ReadStats) are also included.
+type Metrics struct {
+	durationBuckets []float64
+	sizeBuckets     []float64
+
+	mu       sync.Mutex
+	requests map[requestLabels]*requestMetrics
+	inFlight map[requestLabels]int64
+}
+
+// requestLabels identifies a series.  The status is empty for in-flight
+// requests.
+type requestLabels struct {
+	method, route, status string
+}
+
+type requestMetrics struct {
+	count    uint64
+	duration histogram
+	size     histogram
+}
+
+// histogram counts observations into buckets.  The counts are not cumulative;
+// the exposition format's are.
+type histogram struct {
+	counts []uint64 // one per bucket, plus one for +Inf
+	sum    float64
+}
+
+func (h *histogram) observe(bounds []float64, v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(bounds)+1)
+	}
+	h.counts[sort.SearchFloat64s(bounds, v)]++
+	h.sum += v
+}
+
+// NewMetrics creates a Metrics with the given options.
+func NewMetrics(opts MetricsOptions) *Metrics {
+	if opts.DurationBuckets == nil {
+		opts.DurationBuckets = DefaultDurationBuckets
+	}
+	if opts.SizeBuckets == nil {
+		opts.SizeBuckets = DefaultSizeBuckets
+	}
+	return &Metrics{
+		durationBuckets: opts.DurationBuckets,
+		sizeBuckets:     opts.SizeBuckets,
+		requests:        make(map[requestLabels]*requestMetrics),
+		inFlight:        make(map[requestLabels]int64),
+	}
+}
+
+// Middleware records metrics for each request.
+func (m *Metrics) Middleware(ctx *context.Context, h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		method := metricsMethod(r.Method)
+
+		// The route hasn't been matched yet, so look it up.
+		route, _ := wolf.LookupRoute(*ctx, r.Method, r.URL.Path)
+		flight := requestLabels{method: method, route: route.Path}
+		m.mu.Lock()
+		m.inFlight[flight]++
+		m.mu.Unlock()
+
+		lw := WrapWriter(w)
+		defer func() {
+			status := lw.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			labels := requestLabels{
+				method: method,
+				route:  wolf.RoutePattern(*ctx),
+				status: strconv.Itoa(status/100) + "xx",
+			}
+
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
+			// Series for routes with nothing in flight are dropped, so
+			// that the map only holds the requests being handled.
+			m.inFlight[flight]--
+			if m.inFlight[flight] == 0 {
+				delete(m.inFlight, flight)
+			}
+			rm, ok := m.requests[labels]
+			if !ok {
+				rm = &requestMetrics{}
+				m.requests[labels] = rm
+			}
+			rm.count++
+			rm.duration.observe(m.durationBuckets, time.Since(start).Seconds())
+			rm.size.observe(m.sizeBuckets, float64(lw.BytesWritten()))
+		}()
+
+		h.ServeHTTP(lw, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// metricsMethod limits the method label to the standard methods, since
+// clients can send anything.
+func metricsMethod(method string) string {
+	switch method {
+	case "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "CONNECT", "OPTIONS", "TRACE":
+		return method
+	}
+	return "OTHER"
+}
+
+// ServeHTTP implements http.Handler, writing the metrics in the Prometheus
+// text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+
+	bw := bufio.NewWriter(w)
+	m.write(bw)
+	bw.Flush()
+}
+
+func (m *Metrics) write(w *bufio.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]requestLabels, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	sortLabels(keys)
+
+	writeHeader(w, "http_requests_total", "counter", "Number of HTTP requests handled.")
+	for _, k := range keys {
+		writeSample(w, "http_requests_total", k.pairs(), float64(m.requests[k].count))
+	}
+
+	writeHeader(w, "http_request_duration_seconds", "histogram", "Time taken to handle HTTP requests.")
+	for _, k := range keys {
+		writeHistogram(w, "http_request_duration_seconds", k.pairs(), m.durationBuckets, &m.requests[k].duration)
+	}
+
+	writeHeader(w, "http_response_size_bytes", "histogram", "Size of HTTP response bodies.")
+	for _, k := range keys {
+		writeHistogram(w, "http_response_size_bytes", k.pairs(), m.sizeBuckets, &m.requests[k].size)
+	}
+
+	flights := make([]requestLabels, 0, len(m.inFlight))
+	for k := range m.inFlight {
+		flights = append(flights, k)
+	}
+	sortLabels(flights)
+
+	writeHeader(w, "http_requests_in_flight", "gauge", "Number of HTTP requests being handled.")
+	for _, k := range flights {
+		writeSample(w, "http_requests_in_flight", k.pairs(), float64(m.inFlight[k]))
+	}
+
+	stats := wolf.ReadStats()
+	writeHeader(w, "wolf_middleware_stacks_built_total", "counter", "Number of middleware stacks built.")
+	writeSample(w, "wolf_middleware_stacks_built_total", nil, float64(stats.StacksBuilt))
+	writeHeader(w, "wolf_middleware_pool_resets_total", "counter", "Number of times a pool of middleware stacks was discarded.")
+	writeSample(w, "wolf_middleware_pool_resets_total", nil, float64(stats.PoolResets))
+}
+
+func (l requestLabels) pairs() []string {
+	ret := []string{"method", l.method, "route", l.route}
+	if l.status != "" {
+		ret = append(ret, "status", l.status)
+	}
+	return ret
+}
+
+func sortLabels(keys []requestLabels) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+}
+
+func writeHeader(w *bufio.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeHistogram(w *bufio.Writer, name string, pairs []string, bounds []float64, h *histogram) {
+	var cumulative uint64
+	for i, bound := range bounds {
+		if h.counts != nil {
+			cumulative += h.counts[i]
+		}
+		writeSample(w, name+"_bucket", append(pairs, "le", formatFloat(bound)), float64(cumulative))
+	}
+	if h.counts != nil {
+		cumulative += h.counts[len(bounds)]
+	}
+	writeSample(w, name+"_bucket", append(pairs, "le", "+Inf"), float64(cumulative))
+	writeSample(w, name+"_sum", pairs, h.sum)
+	writeSample(w, name+"_count", pairs, float64(cumulative))
+}
+
+// writeSample writes a line with the given name, labels (as alternating names
+// and values) and value.
+func writeSample(w *bufio.Writer, name string, pairs []string, value float64) {
+	w.WriteString(name)
+	if len(pairs) > 0 {
+		w.WriteByte('{')
+		for i := 0; i < len(pairs); i += 2 {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(pairs[i])
+			w.WriteString(`="`)
+			w.WriteString(labelEscaper.Replace(pairs[i+1]))
+			w.WriteByte('"')
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/andrew-d/wolf"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics(MetricsOptions{
+		DurationBuckets: []float64{60},
+		SizeBuckets:     []float64{1, 10},
+	})
+
+	a := wolf.New()
+	a.Use(metrics.Middleware)
+	a.Get("/users/:id", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+	a.Post("/users/:id", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", 400)
+	})
+	a.Get("/metrics", metrics)
+
+	for _, req := range []struct{ method, path string }{
+		{"GET", "/users/1"},
+		{"GET", "/users/2"},
+		{"POST", "/users/3"},
+		{"GET", "/missing"},
+		{"BREW", "/users/1"},
+	} {
+		r, _ := http.NewRequest(req.method, req.path, nil)
+		a.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/metrics", nil)
+	a.ServeHTTP(w, r)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", w.Header().Get("Content-Type"))
+	body := w.Body.String()
+
+	for _, line := range []string{
+		"# TYPE http_requests_total counter",
+		`http_requests_total{method="GET",route="/users/:id",status="2xx"} 2`,
+		`http_requests_total{method="POST",route="/users/:id",status="4xx"} 1`,
+		`http_requests_total{method="GET",route="",status="4xx"} 1`,
+		`http_requests_total{method="OTHER",route="",status="4xx"} 1`,
+
+		"# TYPE http_request_duration_seconds histogram",
+		`http_request_duration_seconds_bucket{method="GET",route="/users/:id",status="2xx",le="60"} 2`,
+		`http_request_duration_seconds_bucket{method="GET",route="/users/:id",status="2xx",le="+Inf"} 2`,
+		`http_request_duration_seconds_count{method="GET",route="/users/:id",status="2xx"} 2`,
+
+		`http_response_size_bytes_bucket{method="GET",route="/users/:id",status="2xx",le="1"} 0`,
+		`http_response_size_bytes_bucket{method="GET",route="/users/:id",status="2xx",le="10"} 2`,
+		`http_response_size_bytes_bucket{method="GET",route="/users/:id",status="2xx",le="+Inf"} 2`,
+		`http_response_size_bytes_sum{method="GET",route="/users/:id",status="2xx"} 10`,
+
+		// The scrape itself is in flight.
+		"# TYPE http_requests_in_flight gauge",
+		`http_requests_in_flight{method="GET",route="/metrics"} 1`,
+
+		"# TYPE wolf_middleware_stacks_built_total counter",
+		"# TYPE wolf_middleware_pool_resets_total counter",
+	} {
+		assert.Contains(t, body, line+"\n")
+	}
+	assert.Contains(t, body, "\nwolf_middleware_stacks_built_total ")
+
+	// Finished requests aren't kept as in-flight series.
+	assert.NotContains(t, body, `http_requests_in_flight{method="GET",route="/users/:id"}`)
+	assert.Len(t, metrics.inFlight, 0)
+}
+
+func TestWriteSampleEscaping(t *testing.T) {
+	var buf strings.Builder
+	bw := bufio.NewWriter(&buf)
+	writeSample(bw, "m", []string{"route", "a\"b\\c\nd"}, 1.5)
+	bw.Flush()
+	assert.Equal(t, `m{route="a\"b\\c\nd"} 1.5`+"\n", buf.String())
+}
@@ -0,0 +1,446 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxPanicGroups is the number of panic groups that a PanicReporter
+// keeps, unless PanicReporterOptions.MaxGroups says otherwise.
+const DefaultMaxPanicGroups = 1000
+
+// PanicRequest describes the request that caused a panic.  Parts that may
+// contain credentials, such as the query string and the Cookie and
+// Authorization headers, are not included.
+type PanicRequest struct {
+	RequestID  string `json:"request_id,omitempty"`
+	Method     string `json:"method"`
+	Path       string `json:"path"`
+	RemoteAddr string `json:"remote_addr"`
+	UserAgent  string `json:"user_agent,omitempty"`
+}
+
+// PanicReport describes a single recovered panic, as sent to a PanicSink.
+type PanicReport struct {
+	Time time.Time
+
+	// Fingerprint identifies the place the panic happened; panics with the
+	// same stack between the panic and the Recoverer (ignoring arguments and
+	// goroutine IDs) have the same fingerprint.
+	Fingerprint string
+
+	// Count is the number of times that panics with this fingerprint have
+	// been seen, including this one.
+	Count int
+
+	// Error is the value that was passed to panic(), formatted with %+v.
+	Error string
+
+	Stack   []byte
+	Request PanicRequest
+}
+
+// PanicGroup summarizes all the panics with one fingerprint.
+type PanicGroup struct {
+	Fingerprint string       `json:"fingerprint"`
+	Count       int          `json:"count"`
+	FirstSeen   time.Time    `json:"first_seen"`
+	LastSeen    time.Time    `json:"last_seen"`
+	Error       string       `json:"error"`
+	Stack       string       `json:"stack"`
+	Sample      PanicRequest `json:"sample_request"`
+}
+
+// PanicSink receives reports from a PanicReporter.  Report may be called
+// concurrently from multiple goroutines.
+type PanicSink interface {
+	Report(report *PanicReport)
+}
+
+// PanicReporterOptions controls the behaviour of a PanicReporter.
+type PanicReporterOptions struct {
+	// Sinks receive every panic.  Defaults to a logfmt PanicWriterSink
+	// writing to os.Stderr.
+	Sinks []PanicSink
+
+	// MaxGroups is the number of groups to keep.  When there are more, the
+	// group that was seen least recently is forgotten.  Defaults to
+	// DefaultMaxPanicGroups.
+	MaxGroups int
+}
+
+// PanicReporter groups recovered panics by fingerprint, and sends them to
+// sinks.  Use its Recover method with CustomRecoverer:
+//
+//	reporter := middleware.NewPanicReporter(middleware.PanicReporterOptions{})
+//	a.Use(middleware.CustomRecoverer(reporter.Recover))
+//	a.Get("/debug/panics", reporter)
+//
+// PanicReporter is itself a http.Handler that lists the groups as JSON, most
+// recently seen first.
+type PanicReporter struct {
+	sinks     []PanicSink
+	maxGroups int
+
+	mu     sync.Mutex
+	groups map[string]*PanicGroup
+}
+
+// NewPanicReporter creates a PanicReporter with the given options.
+func NewPanicReporter(opts PanicReporterOptions) *PanicReporter {
+	if len(opts.Sinks) == 0 {
+		opts.Sinks = []PanicSink{NewPanicWriterSink(os.Stderr, LogfmtFormat)}
+	}
+	if opts.MaxGroups <= 0 {
+		opts.MaxGroups = DefaultMaxPanicGroups
+	}
+	return &PanicReporter{
+		sinks:     opts.Sinks,
+		maxGroups: opts.MaxGroups,
+		groups:    make(map[string]*PanicGroup),
+	}
+}
+
+// Recover is a RecoverFunc that reports the panic, and then sends an error to
+// the client in the same way as Recoverer.
+func (p *PanicReporter) Recover(w http.ResponseWriter, r *http.Request, info RecoverInformation) {
+	p.Report(r, info)
+	writeRecoverError(w, r, info)
+}
+
+// Report records a panic that happened while serving r, and sends it to the
+// sinks.
+func (p *PanicReporter) Report(r *http.Request, info RecoverInformation) {
+	report := &PanicReport{
+		Time:        time.Now(),
+		Fingerprint: panicFingerprint(info.Stack),
+		Error:       fmt.Sprintf("%+v", info.Error),
+		Stack:       info.Stack,
+		Request: PanicRequest{
+			RequestID:  info.RequestID,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			RemoteAddr: r.RemoteAddr,
+			UserAgent:  r.UserAgent(),
+		},
+	}
+
+	p.mu.Lock()
+	g, ok := p.groups[report.Fingerprint]
+	if !ok {
+		if len(p.groups) >= p.maxGroups {
+			p.evictLocked()
+		}
+		g = &PanicGroup{
+			Fingerprint: report.Fingerprint,
+			FirstSeen:   report.Time,
+			Error:       report.Error,
+			Stack:       string(report.Stack),
+		}
+		p.groups[report.Fingerprint] = g
+	}
+	g.Count++
+	g.LastSeen = report.Time
+	g.Sample = report.Request
+	report.Count = g.Count
+	p.mu.Unlock()
+
+	for _, sink := range p.sinks {
+		sink.Report(report)
+	}
+}
+
+// evictLocked forgets the group that was seen least recently.
+func (p *PanicReporter) evictLocked() {
+	var oldest *PanicGroup
+	for _, g := range p.groups {
+		if oldest == nil || g.LastSeen.Before(oldest.LastSeen) {
+			oldest = g
+		}
+	}
+	if oldest != nil {
+		delete(p.groups, oldest.Fingerprint)
+	}
+}
+
+// Groups returns a copy of the panic groups, most recently seen first.
+func (p *PanicReporter) Groups() []PanicGroup {
+	p.mu.Lock()
+	groups := make([]PanicGroup, 0, len(p.groups))
+	for _, g := range p.groups {
+		groups = append(groups, *g)
+	}
+	p.mu.Unlock()
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].LastSeen.After(groups[j].LastSeen)
+	})
+	return groups
+}
+
+// ServeHTTP implements http.Handler.
+func (p *PanicReporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(p.Groups())
+}
+
+// recovererFunc is the name of CustomRecoverer in stack traces.  Frames from
+// it, and those below it, are the same for every panic.
+var recovererFunc = runtime.FuncForPC(reflect.ValueOf(CustomRecoverer).Pointer()).Name()
+
+// panicFingerprint hashes the functions and source lines in a stack trace
+// from debug.Stack, from the call to panic up to the Recoverer.  It leaves
+// out the goroutine ID, argument values and program counter offsets, which
+// differ between occurrences of the same panic.
+func panicFingerprint(stack []byte) string {
+	lines := strings.Split(string(stack), "\n")
+
+	// Skip the frames of the Recoverer's deferred function, if present.
+	for i, line := range lines {
+		if strings.HasPrefix(line, "panic(") {
+			lines = lines[i+1:]
+			break
+		}
+	}
+
+	h := sha256.New()
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, recovererFunc+"."):
+			return hex.EncodeToString(h.Sum(nil)[:8])
+		case strings.HasPrefix(line, "goroutine "), line == "":
+			continue
+		case strings.HasPrefix(line, "\t"):
+			// A file and line, e.g. "\t/src/main.go:10 +0x25".
+			if i := strings.LastIndex(line, " +0x"); i >= 0 {
+				line = line[:i]
+			}
+		default:
+			// A function, e.g. "main.foo(0xc000010000, 0x1)".
+			if i := strings.LastIndex(line, "("); i >= 0 {
+				line = line[:i]
+			}
+		}
+		io.WriteString(h, line)
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// PanicWriterSink is a PanicSink that writes each report to an io.Writer.  In
+// LogfmtFormat, a line describing the panic is followed by the stack trace; in
+// JSONFormat, each report is written as a single line.
+type PanicWriterSink struct {
+	format LogFormat
+
+	mu  sync.Mutex
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+// NewPanicWriterSink creates a PanicWriterSink that writes to w in the given
+// format.
+func NewPanicWriterSink(w io.Writer, format LogFormat) *PanicWriterSink {
+	return &PanicWriterSink{w: w, format: format}
+}
+
+// PanicFileSink is a PanicWriterSink that appends to a file.
+type PanicFileSink struct {
+	*PanicWriterSink
+	f *os.File
+}
+
+// NewPanicFileSink creates a PanicFileSink that appends to the named file in
+// the given format, creating the file if necessary.
+func NewPanicFileSink(path string, format LogFormat) (*PanicFileSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &PanicFileSink{NewPanicWriterSink(f, format), f}, nil
+}
+
+// Close closes the sink's file.
+func (s *PanicFileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
+
+// Report implements PanicSink.
+func (s *PanicWriterSink) Report(report *PanicReport) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buf.Reset()
+	if s.format == JSONFormat {
+		json.NewEncoder(&s.buf).Encode(newPanicReportJSON(report))
+	} else {
+		writeLogfmtPair(&s.buf, "time", report.Time.UTC().Format(time.RFC3339Nano))
+		if report.Request.RequestID != "" {
+			writeLogfmtPair(&s.buf, "request_id", report.Request.RequestID)
+		}
+		writeLogfmtPair(&s.buf, "fingerprint", report.Fingerprint)
+		writeLogfmtPair(&s.buf, "count", strconv.Itoa(report.Count))
+		writeLogfmtPair(&s.buf, "method", report.Request.Method)
+		writeLogfmtPair(&s.buf, "path", report.Request.Path)
+		writeLogfmtPair(&s.buf, "panic", report.Error)
+		s.buf.WriteByte('\n')
+		s.buf.Write(report.Stack)
+	}
+	s.w.Write(s.buf.Bytes())
+}
+
+// panicReportJSON is how a PanicReport is encoded by PanicWriterSink and
+// PanicWebhookSink.
+type panicReportJSON struct {
+	Time        string       `json:"time"`
+	Fingerprint string       `json:"fingerprint"`
+	Count       int          `json:"count"`
+	Error       string       `json:"error"`
+	Stack       string       `json:"stack"`
+	Request     PanicRequest `json:"request"`
+}
+
+func newPanicReportJSON(report *PanicReport) panicReportJSON {
+	return panicReportJSON{
+		Time:        report.Time.UTC().Format(time.RFC3339Nano),
+		Fingerprint: report.Fingerprint,
+		Count:       report.Count,
+		Error:       report.Error,
+		Stack:       string(report.Stack),
+		Request:     report.Request,
+	}
+}
+
+// PanicWebhookOptions controls the behaviour of a PanicWebhookSink.
+type PanicWebhookOptions struct {
+	// URL is where reports are POSTed, as JSON.  It is required.
+	URL string
+
+	// Client sends the requests.  Defaults to a client with a 10 second
+	// timeout.
+	Client *http.Client
+
+	// QueueSize is the number of reports that can be waiting to be sent.
+	// Reports are dropped when the queue is full, so that a flood of panics
+	// doesn't hold up requests.  Defaults to 100.
+	QueueSize int
+
+	// OnError, if set, is called when a report can't be sent or is dropped.
+	OnError func(report *PanicReport, err error)
+}
+
+// PanicWebhookSink is a PanicSink that POSTs each report to a URL in the
+// background.
+type PanicWebhookSink struct {
+	opts  PanicWebhookOptions
+	queue chan *PanicReport
+	done  chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewPanicWebhookSink creates a PanicWebhookSink, and starts the goroutine
+// that sends its reports.  Call Close to stop it.
+func NewPanicWebhookSink(opts PanicWebhookOptions) *PanicWebhookSink {
+	if opts.URL == "" {
+		panic("middleware: PanicWebhookSink requires a URL")
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 100
+	}
+
+	s := &PanicWebhookSink{
+		opts:  opts,
+		queue: make(chan *PanicReport, opts.QueueSize),
+		done:  make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Report implements PanicSink.
+func (s *PanicWebhookSink) Report(report *PanicReport) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		s.fail(report, fmt.Errorf("middleware: PanicWebhookSink is closed"))
+		return
+	}
+	select {
+	case s.queue <- report:
+	default:
+		s.fail(report, fmt.Errorf("middleware: PanicWebhookSink queue is full"))
+	}
+}
+
+// Close sends any reports that are waiting, and stops the sink.
+func (s *PanicWebhookSink) Close() {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+
+	<-s.done
+}
+
+func (s *PanicWebhookSink) run() {
+	defer close(s.done)
+
+	for report := range s.queue {
+		if err := s.send(report); err != nil {
+			s.fail(report, err)
+		}
+	}
+}
+
+func (s *PanicWebhookSink) send(report *PanicReport) error {
+	body, err := json.Marshal(newPanicReportJSON(report))
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.opts.Client.Post(s.opts.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("middleware: panic webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *PanicWebhookSink) fail(report *PanicReport, err error) {
+	if s.opts.OnError != nil {
+		s.opts.OnError(report, err)
+	}
+}
@@ -0,0 +1,222 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/andrew-d/wolf"
+	"github.com/andrew-d/wolf/wolftest"
+)
+
+// recordingSink is a PanicSink that remembers the reports it gets.
+type recordingSink struct {
+	mu      sync.Mutex
+	reports []*PanicReport
+}
+
+func (s *recordingSink) Report(report *PanicReport) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reports = append(s.reports, report)
+}
+
+func TestPanicReporter(t *testing.T) {
+	sink := &recordingSink{}
+	reporter := NewPanicReporter(PanicReporterOptions{Sinks: []PanicSink{sink}})
+
+	a := wolf.New()
+	a.Use(CustomRecoverer(reporter.Recover))
+	a.Get("/a", func(w http.ResponseWriter, r *http.Request) {
+		panic("a")
+	})
+	a.Get("/b", func(w http.ResponseWriter, r *http.Request) {
+		panic("b")
+	})
+	a.Get("/debug/panics", reporter)
+
+	wolftest.NewRequest("GET", "/a?x=1").WithHeader("User-Agent", "test-agent").Serve(a).AssertStatus(t, 500)
+	wolftest.NewRequest("GET", "/a?x=2").Serve(a).AssertStatus(t, 500)
+	wolftest.NewRequest("GET", "/b").Serve(a).AssertStatus(t, 500)
+
+	if assert.Len(t, sink.reports, 3) {
+		assert.Equal(t, sink.reports[0].Fingerprint, sink.reports[1].Fingerprint)
+		assert.NotEqual(t, sink.reports[0].Fingerprint, sink.reports[2].Fingerprint)
+		assert.Equal(t, 1, sink.reports[0].Count)
+		assert.Equal(t, 2, sink.reports[1].Count)
+		assert.Equal(t, "a", sink.reports[0].Error)
+		assert.Equal(t, "/a", sink.reports[0].Request.Path)
+		assert.Equal(t, "test-agent", sink.reports[0].Request.UserAgent)
+	}
+
+	groups := reporter.Groups()
+	if assert.Len(t, groups, 2) {
+		assert.Equal(t, "b", groups[0].Error)
+		assert.Equal(t, 1, groups[0].Count)
+		assert.Equal(t, "a", groups[1].Error)
+		assert.Equal(t, 2, groups[1].Count)
+		assert.Equal(t, "/a", groups[1].Sample.Path)
+		assert.True(t, groups[1].LastSeen.After(groups[1].FirstSeen))
+	}
+
+	// The debug endpoint lists the groups.
+	resp := wolftest.NewRequest("GET", "/debug/panics").Serve(a)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	var listed []PanicGroup
+	assert.NoError(t, resp.DecodeJSON(&listed))
+	if assert.Len(t, listed, 2) {
+		assert.Equal(t, groups[0].Fingerprint, listed[0].Fingerprint)
+		assert.Equal(t, 2, listed[1].Count)
+	}
+}
+
+func TestPanicReporterMaxGroups(t *testing.T) {
+	reporter := NewPanicReporter(PanicReporterOptions{
+		Sinks:     []PanicSink{&recordingSink{}},
+		MaxGroups: 1,
+	})
+
+	a := wolf.New()
+	a.Use(CustomRecoverer(reporter.Recover))
+	a.Get("/a", func(w http.ResponseWriter, r *http.Request) {
+		panic("a")
+	})
+	a.Get("/b", func(w http.ResponseWriter, r *http.Request) {
+		panic("b")
+	})
+
+	wolftest.NewRequest("GET", "/a").Serve(a)
+	wolftest.NewRequest("GET", "/b").Serve(a)
+
+	groups := reporter.Groups()
+	if assert.Len(t, groups, 1) {
+		assert.Equal(t, "b", groups[0].Error)
+	}
+}
+
+func TestPanicFingerprint(t *testing.T) {
+	stack := func(goroutine, arg, line, offset, caller string) []byte {
+		return []byte("goroutine " + goroutine + " [running]:\n" +
+			"runtime/debug.Stack()\n" +
+			"\t/go/src/runtime/debug/stack.go:26 +0x5e\n" +
+			recovererFunc + ".func1.1.1()\n" +
+			"\t/src/recoverer.go:70 +0x65\n" +
+			"panic({0xee5dc8?, 0x9d40e0?})\n" +
+			"\t/go/src/runtime/panic.go:783 +0x132\n" +
+			"main.handler(" + arg + ")\n" +
+			"\t/src/main.go:" + line + " +" + offset + "\n" +
+			recovererFunc + ".func1.1(" + arg + ")\n" +
+			"\t/src/recoverer.go:80 +0x25\n" +
+			"main.main()\n" +
+			"\t/src/main.go:" + caller + " +0x11\n")
+	}
+
+	fp := panicFingerprint(stack("7", "0xc000010000", "10", "0x25", "20"))
+	assert.Len(t, fp, 16)
+	assert.Equal(t, fp, panicFingerprint(stack("42", "0xc000abcdef", "10", "0x31", "21")))
+	assert.NotEqual(t, fp, panicFingerprint(stack("7", "0xc000010000", "11", "0x25", "20")))
+}
+
+func testPanicReport() *PanicReport {
+	return &PanicReport{
+		Fingerprint: "0123456789abcdef",
+		Count:       3,
+		Error:       "oh no",
+		Stack:       []byte("goroutine 1 [running]:\nmain.main()\n"),
+		Request:     PanicRequest{RequestID: "req-1", Method: "GET", Path: "/x"},
+	}
+}
+
+func TestPanicWriterSink(t *testing.T) {
+	var buf bytes.Buffer
+	NewPanicWriterSink(&buf, LogfmtFormat).Report(testPanicReport())
+	assert.Equal(t, "time=0001-01-01T00:00:00Z request_id=req-1 fingerprint=0123456789abcdef "+
+		"count=3 method=GET path=/x panic=\"oh no\"\n"+
+		"goroutine 1 [running]:\nmain.main()\n", buf.String())
+
+	buf.Reset()
+	NewPanicWriterSink(&buf, JSONFormat).Report(testPanicReport())
+	assert.JSONEq(t, `{
+		"time": "0001-01-01T00:00:00Z",
+		"fingerprint": "0123456789abcdef",
+		"count": 3,
+		"error": "oh no",
+		"stack": "goroutine 1 [running]:\nmain.main()\n",
+		"request": {"request_id": "req-1", "method": "GET", "path": "/x", "remote_addr": ""}
+	}`, buf.String())
+	assert.Equal(t, 1, strings.Count(buf.String(), "\n"))
+}
+
+func TestPanicFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "panics")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "panics.log")
+	for i := 0; i < 2; i++ {
+		sink, err := NewPanicFileSink(path, JSONFormat)
+		if !assert.NoError(t, err) {
+			return
+		}
+		sink.Report(testPanicReport())
+		assert.NoError(t, sink.Close())
+	}
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(data), `"fingerprint":"0123456789abcdef"`))
+}
+
+func TestPanicWebhookSink(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []map[string]interface{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		received = append(received, body)
+		mu.Unlock()
+
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(503)
+		}
+	}))
+	defer srv.Close()
+
+	sink := NewPanicWebhookSink(PanicWebhookOptions{URL: srv.URL + "/hook"})
+	sink.Report(testPanicReport())
+	sink.Close()
+
+	if assert.Len(t, received, 1) {
+		assert.Equal(t, "0123456789abcdef", received[0]["fingerprint"])
+		assert.Equal(t, "oh no", received[0]["error"])
+	}
+
+	// Failures, and reports after closing, are passed to OnError.
+	var errs []error
+	sink = NewPanicWebhookSink(PanicWebhookOptions{
+		URL: srv.URL + "/fail",
+		OnError: func(report *PanicReport, err error) {
+			errs = append(errs, err)
+		},
+	})
+	sink.Report(testPanicReport())
+	sink.Close()
+	sink.Report(testPanicReport())
+
+	if assert.Len(t, errs, 2) {
+		assert.Contains(t, errs[0].Error(), "503")
+		assert.Contains(t, errs[1].Error(), "closed")
+	}
+}
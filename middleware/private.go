@@ -1,4 +1,4 @@
 package middleware
 
-// This type is used as something that nobody else can take the address of
-type private struct{}
+// Internal private type for context keys.
+type private int
@@ -0,0 +1,360 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// RateLimitStore stores the state of rate limiters, keyed by client.  The
+// state is opaque to the store, so that it can be kept somewhere shared
+// between processes.  Implementations must be safe for concurrent use.
+type RateLimitStore interface {
+	// Update atomically replaces the state stored under key (nil if there
+	// is none) with the result of calling fn on it.  The store may discard
+	// the state once it has not been updated for ttl.
+	Update(key string, ttl time.Duration, fn func(state []byte) []byte) error
+}
+
+// RateLimitAlgorithm decides whether requests are allowed.  Use TokenBucket
+// or SlidingWindow to create one.
+type RateLimitAlgorithm interface {
+	// take records a request at the given time against the given state, and
+	// returns the new state along with the result.
+	take(state []byte, now time.Time) ([]byte, rateLimitResult)
+
+	// ttl is how long state must be kept for it to be useful.
+	ttl() time.Duration
+}
+
+type rateLimitResult struct {
+	allowed    bool
+	limit      int
+	remaining  int
+	reset      time.Duration // until the limit is fully replenished
+	retryAfter time.Duration // until the next request will be allowed
+}
+
+// RateLimitOptions controls the behaviour of the RateLimit middleware.
+type RateLimitOptions struct {
+	// Algorithm decides whether each request is allowed.  It is required.
+	Algorithm RateLimitAlgorithm
+
+	// Key returns the key that identifies the client making a request; each
+	// key is limited separately.  Requests for which it returns the empty
+	// string are not limited.  Defaults to KeyByIP.
+	Key func(ctx context.Context, r *http.Request) string
+
+	// Store holds the state of each key.  Defaults to a new
+	// MemoryRateLimitStore.
+	Store RateLimitStore
+
+	// KeyPrefix is prepended to every key.  Set it to something unique when
+	// multiple limiters share a Store.
+	KeyPrefix string
+
+	// OnLimited, if set, is called to write the response when a request is
+	// rejected.  By default a HTTP 429 (Too Many Requests) is sent.
+	OnLimited http.Handler
+}
+
+// RateLimit creates a middleware that limits the rate of requests from each
+// client, as identified by the Key option.  Use it with App.Use to limit all
+// requests, or with wolf.With to set a limit on a single route:
+//
+//	limit := middleware.RateLimit(middleware.RateLimitOptions{
+//		Algorithm: middleware.SlidingWindow(5, time.Minute),
+//	})
+//	a.Post("/login", wolf.With(login, limit))
+//
+// The current limit is described to the client with the RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset headers, and rejected requests
+// also get a Retry-After header.  If the store fails, requests are allowed.
+func RateLimit(opts RateLimitOptions) func(*context.Context, http.Handler) http.Handler {
+	if opts.Algorithm == nil {
+		panic("middleware: RateLimit requires an Algorithm")
+	}
+	if opts.Key == nil {
+		opts.Key = KeyByIP
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryRateLimitStore()
+	}
+	if opts.OnLimited == nil {
+		opts.OnLimited = http.HandlerFunc(defaultLimitedHandler)
+	}
+	ttl := opts.Algorithm.ttl()
+
+	middlewareFunc := func(ctx *context.Context, h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			key := opts.Key(*ctx, r)
+			if key == "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			var res rateLimitResult
+			now := time.Now()
+			err := opts.Store.Update(opts.KeyPrefix+key, ttl, func(state []byte) []byte {
+				var newState []byte
+				newState, res = opts.Algorithm.take(state, now)
+				return newState
+			})
+			if err != nil {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			hdr := w.Header()
+			hdr.Set("RateLimit-Limit", strconv.Itoa(res.limit))
+			hdr.Set("RateLimit-Remaining", strconv.Itoa(res.remaining))
+			hdr.Set("RateLimit-Reset", ceilSeconds(res.reset))
+
+			if !res.allowed {
+				hdr.Set("Retry-After", ceilSeconds(res.retryAfter))
+				opts.OnLimited.ServeHTTP(w, r)
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+
+	return middlewareFunc
+}
+
+func defaultLimitedHandler(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, http.StatusText(429), 429)
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// KeyByIP identifies clients by their IP address.  If the RealIP middleware
+// has run, the address that it found is used.
+func KeyByIP(ctx context.Context, r *http.Request) string {
+	if ip := ClientIP(ctx); ip != "" {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// KeyByHeader returns a function that identifies clients by the value of the
+// given request header.  Clients that don't send the header are identified by
+// their IP address instead.
+//
+// Each distinct value is limited separately, so a client that sends a new
+// value with every request is never limited.  Only use it for headers whose
+// values have already been checked, e.g. by authentication middleware that
+// runs before RateLimit, or add a second limiter keyed by IP as well.
+func KeyByHeader(name string) func(context.Context, *http.Request) string {
+	return func(ctx context.Context, r *http.Request) string {
+		if v := r.Header.Get(name); v != "" {
+			return "header:" + v
+		}
+		return KeyByIP(ctx, r)
+	}
+}
+
+// KeyByAPIKey is like KeyByHeader, but is intended for headers containing
+// secrets: the value is hashed, so that it isn't kept in the store.  As with
+// KeyByHeader, invalid keys each get their own limit, so check keys before
+// the limiter runs.
+func KeyByAPIKey(name string) func(context.Context, *http.Request) string {
+	return func(ctx context.Context, r *http.Request) string {
+		if v := r.Header.Get(name); v != "" {
+			sum := sha256.Sum256([]byte(v))
+			return "key:" + hex.EncodeToString(sum[:16])
+		}
+		return KeyByIP(ctx, r)
+	}
+}
+
+// TokenBucket returns an algorithm that allows bursts of up to burst
+// requests, refilled at a steady rate of n requests per the given period.  It
+// panics unless n, per and burst are all positive.
+func TokenBucket(n int, per time.Duration, burst int) RateLimitAlgorithm {
+	if n <= 0 || per <= 0 || burst <= 0 {
+		panic("middleware: TokenBucket requires a positive n, per and burst")
+	}
+
+	interval := per / time.Duration(n)
+	if interval == 0 {
+		// More than one token per nanosecond; near enough.
+		interval = 1
+	}
+	return &tokenBucket{
+		burst:    burst,
+		interval: interval,
+	}
+}
+
+type tokenBucket struct {
+	burst    int
+	interval time.Duration // time to refill one token
+}
+
+func (tb *tokenBucket) ttl() time.Duration {
+	return tb.interval * time.Duration(tb.burst)
+}
+
+// The state is the number of tokens, and the time it was last updated.
+func (tb *tokenBucket) take(state []byte, now time.Time) ([]byte, rateLimitResult) {
+	tokens := float64(tb.burst)
+	if len(state) == 16 {
+		tokens = math.Float64frombits(binary.BigEndian.Uint64(state[0:8]))
+		last := time.Unix(0, int64(binary.BigEndian.Uint64(state[8:16])))
+
+		tokens += float64(now.Sub(last)) / float64(tb.interval)
+		tokens = math.Min(tokens, float64(tb.burst))
+	}
+
+	res := rateLimitResult{limit: tb.burst}
+	if tokens >= 1 {
+		tokens--
+		res.allowed = true
+	} else {
+		res.retryAfter = time.Duration((1 - tokens) * float64(tb.interval))
+	}
+	res.remaining = int(tokens)
+	res.reset = time.Duration((float64(tb.burst) - tokens) * float64(tb.interval))
+
+	newState := make([]byte, 16)
+	binary.BigEndian.PutUint64(newState[0:8], math.Float64bits(tokens))
+	binary.BigEndian.PutUint64(newState[8:16], uint64(now.UnixNano()))
+	return newState, res
+}
+
+// SlidingWindow returns an algorithm that allows up to limit requests in any
+// window of the given length.  It approximates a true sliding window by
+// weighting the count from the previous fixed window by how much of it
+// overlaps the sliding one.  It panics unless limit and window are positive.
+func SlidingWindow(limit int, window time.Duration) RateLimitAlgorithm {
+	if limit <= 0 || window <= 0 {
+		panic("middleware: SlidingWindow requires a positive limit and window")
+	}
+	return &slidingWindow{limit: limit, window: window}
+}
+
+type slidingWindow struct {
+	limit  int
+	window time.Duration
+}
+
+func (sw *slidingWindow) ttl() time.Duration {
+	return 2 * sw.window
+}
+
+// The state is the start of the current fixed window, and the counts in it
+// and the previous one.
+func (sw *slidingWindow) take(state []byte, now time.Time) ([]byte, rateLimitResult) {
+	start := now.Truncate(sw.window)
+
+	var prev, cur int64
+	if len(state) == 24 {
+		oldStart := time.Unix(0, int64(binary.BigEndian.Uint64(state[0:8])))
+		oldPrev := int64(binary.BigEndian.Uint64(state[8:16]))
+		oldCur := int64(binary.BigEndian.Uint64(state[16:24]))
+
+		switch {
+		case oldStart.Equal(start):
+			prev, cur = oldPrev, oldCur
+		case oldStart.Add(sw.window).Equal(start):
+			prev = oldCur
+		}
+	}
+
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(sw.window)
+	estimate := float64(prev)*weight + float64(cur)
+
+	res := rateLimitResult{
+		limit: sw.limit,
+		reset: sw.window - elapsed,
+	}
+	if estimate+1 <= float64(sw.limit) {
+		cur++
+		estimate++
+		res.allowed = true
+	} else if cur+1 > int64(sw.limit) || prev == 0 {
+		// Nothing will change until the next window.
+		res.retryAfter = sw.window - elapsed
+	} else {
+		// Wait until enough of the previous window has slid out.
+		needed := 1 - (float64(sw.limit)-float64(cur)-1)/float64(prev)
+		res.retryAfter = time.Duration(needed*float64(sw.window)) - elapsed
+	}
+	res.remaining = sw.limit - int(math.Ceil(estimate))
+	if res.remaining < 0 {
+		res.remaining = 0
+	}
+
+	newState := make([]byte, 24)
+	binary.BigEndian.PutUint64(newState[0:8], uint64(start.UnixNano()))
+	binary.BigEndian.PutUint64(newState[8:16], uint64(prev))
+	binary.BigEndian.PutUint64(newState[16:24], uint64(cur))
+	return newState, res
+}
+
+// MemoryRateLimitStore is a RateLimitStore that keeps state in memory.
+// Expired state is removed periodically as the store is used.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	entries   map[string]memoryRateLimitEntry
+	lastSweep time.Time
+}
+
+type memoryRateLimitEntry struct {
+	state   []byte
+	expires time.Time
+}
+
+// NewMemoryRateLimitStore creates an empty MemoryRateLimitStore.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		entries:   make(map[string]memoryRateLimitEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+// Update implements RateLimitStore.
+func (m *MemoryRateLimitStore) Update(key string, ttl time.Duration, fn func([]byte) []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.lastSweep) > time.Minute {
+		for k, e := range m.entries {
+			if now.After(e.expires) {
+				delete(m.entries, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	var state []byte
+	if e, ok := m.entries[key]; ok && now.Before(e.expires) {
+		state = e.state
+	}
+
+	m.entries[key] = memoryRateLimitEntry{
+		state:   fn(state),
+		expires: now.Add(ttl),
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf"
+	"github.com/andrew-d/wolf/wolftest"
+)
+
+// Test that a per-route limiter rejects requests once the burst is used, and
+// only applies to its own route.
+func TestRateLimitTokenBucket(t *testing.T) {
+	a := wolf.New()
+	a.Get("/", okHandler)
+	a.Get("/limited", wolf.With(okHandler, RateLimit(RateLimitOptions{
+		Algorithm: TokenBucket(1, time.Minute, 2),
+	})))
+
+	// wolftest's requests come from 192.0.2.1.
+	resp := wolftest.NewRequest("GET", "/limited").Serve(a)
+	resp.AssertStatus(t, 200)
+	assert.Equal(t, "2", resp.Header.Get("RateLimit-Limit"))
+	assert.Equal(t, "1", resp.Header.Get("RateLimit-Remaining"))
+	assert.Equal(t, "60", resp.Header.Get("RateLimit-Reset"))
+
+	resp = wolftest.NewRequest("GET", "/limited").Serve(a)
+	resp.AssertStatus(t, 200)
+	assert.Equal(t, "0", resp.Header.Get("RateLimit-Remaining"))
+
+	resp = wolftest.NewRequest("GET", "/limited").Serve(a)
+	resp.AssertStatus(t, 429)
+	assert.Equal(t, "0", resp.Header.Get("RateLimit-Remaining"))
+	assert.Equal(t, "60", resp.Header.Get("Retry-After"))
+
+	// Other clients and other routes are unaffected.
+	wolftest.NewRequest("GET", "/limited").WithRemoteAddr("192.0.2.2:1234").Serve(a).AssertStatus(t, 200)
+
+	resp = wolftest.NewRequest("GET", "/").Serve(a)
+	resp.AssertStatus(t, 200)
+	assert.Equal(t, "", resp.Header.Get("RateLimit-Limit"))
+}
+
+func TestTokenBucketRefill(t *testing.T) {
+	tb := TokenBucket(10, time.Second, 1)
+	now := time.Now()
+
+	state, res := tb.take(nil, now)
+	assert.True(t, res.allowed)
+	state, res = tb.take(state, now.Add(50*time.Millisecond))
+	assert.False(t, res.allowed)
+	assert.Equal(t, 50*time.Millisecond, res.retryAfter)
+
+	// A rejected request doesn't use up any tokens.
+	_, res = tb.take(state, now.Add(100*time.Millisecond))
+	assert.True(t, res.allowed)
+}
+
+func TestRateLimitAlgorithmArguments(t *testing.T) {
+	assert.Panics(t, func() { TokenBucket(0, time.Minute, 1) })
+	assert.Panics(t, func() { TokenBucket(1, time.Minute, -1) })
+	assert.Panics(t, func() { TokenBucket(-1, time.Minute, 1) })
+	assert.Panics(t, func() { TokenBucket(1, 0, 1) })
+	assert.Panics(t, func() { SlidingWindow(0, time.Minute) })
+	assert.Panics(t, func() { SlidingWindow(1, 0) })
+	assert.NotPanics(t, func() { TokenBucket(10, time.Nanosecond, 1) })
+}
+
+func TestSlidingWindow(t *testing.T) {
+	sw := SlidingWindow(4, time.Minute)
+	start := time.Now().Truncate(time.Minute)
+
+	var state []byte
+	var res rateLimitResult
+	for i := 0; i < 4; i++ {
+		state, res = sw.take(state, start.Add(30*time.Second))
+		assert.True(t, res.allowed)
+	}
+	assert.Equal(t, 0, res.remaining)
+
+	state, res = sw.take(state, start.Add(45*time.Second))
+	assert.False(t, res.allowed)
+	assert.Equal(t, 15*time.Second, res.retryAfter)
+
+	// A quarter of the way into the next window, three quarters of the
+	// previous window's requests still count.
+	state, res = sw.take(state, start.Add(75*time.Second))
+	assert.True(t, res.allowed)
+	assert.Equal(t, 0, res.remaining)
+
+	state, res = sw.take(state, start.Add(80*time.Second))
+	assert.False(t, res.allowed)
+	assert.Equal(t, 10*time.Second, res.retryAfter)
+
+	state, res = sw.take(state, start.Add(90*time.Second))
+	assert.True(t, res.allowed)
+	assert.Equal(t, 0, res.remaining)
+
+	// Once two windows have passed, everything is forgotten.
+	_, res = sw.take(state, start.Add(180*time.Second))
+	assert.True(t, res.allowed)
+	assert.Equal(t, 3, res.remaining)
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	a := wolf.New()
+	a.Use(RateLimit(RateLimitOptions{
+		Algorithm: TokenBucket(1, time.Minute, 1),
+		Key:       KeyByAPIKey("X-API-Key"),
+	}))
+	a.Get("/", okHandler)
+
+	wolftest.NewRequest("GET", "/").WithHeader("X-API-Key", "secret").Serve(a).AssertStatus(t, 200)
+
+	// The same key from a different address is limited...
+	wolftest.NewRequest("GET", "/").
+		WithHeader("X-API-Key", "secret").
+		WithRemoteAddr("192.0.2.2:1234").
+		Serve(a).
+		AssertStatus(t, 429)
+
+	// ... but a different key isn't, and without a key the address is used.
+	wolftest.NewRequest("GET", "/").WithHeader("X-API-Key", "other").Serve(a).AssertStatus(t, 200)
+	wolftest.NewRequest("GET", "/").Serve(a).AssertStatus(t, 200)
+
+	// Requests without a key aren't limited at all.
+	a = wolf.New()
+	a.Use(RateLimit(RateLimitOptions{
+		Algorithm: TokenBucket(1, time.Minute, 1),
+		Key: func(_ context.Context, r *http.Request) string {
+			return r.Header.Get("X-User")
+		},
+	}))
+	a.Get("/", okHandler)
+	for i := 0; i < 3; i++ {
+		wolftest.NewRequest("GET", "/").Serve(a).AssertStatus(t, 200)
+	}
+}
+
+func TestKeyByHeader(t *testing.T) {
+	key := KeyByHeader("X-Client")
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "[2001:db8::1]:1234"
+	assert.Equal(t, "2001:db8::1", key(context.Background(), r))
+
+	r.Header.Set("X-Client", "abc")
+	assert.Equal(t, "header:abc", key(context.Background(), r))
+}
+
+type failingStore struct{}
+
+func (failingStore) Update(string, time.Duration, func([]byte) []byte) error {
+	return errors.New("unavailable")
+}
+
+// Test that requests are allowed if the store fails, and that OnLimited is
+// used for rejections.
+func TestRateLimitOptions(t *testing.T) {
+	a := wolf.New()
+	a.Use(RateLimit(RateLimitOptions{
+		Algorithm: TokenBucket(1, time.Minute, 1),
+		Store:     failingStore{},
+	}))
+	a.Get("/", okHandler)
+	for i := 0; i < 3; i++ {
+		resp := wolftest.NewRequest("GET", "/").Serve(a)
+		resp.AssertStatus(t, 200)
+		assert.Equal(t, "", resp.Header.Get("RateLimit-Limit"))
+	}
+
+	a = wolf.New()
+	a.Use(RateLimit(RateLimitOptions{
+		Algorithm: TokenBucket(1, time.Minute, 1),
+		OnLimited: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(503)
+		}),
+	}))
+	a.Get("/", okHandler)
+	wolftest.NewRequest("GET", "/").Serve(a)
+	resp := wolftest.NewRequest("GET", "/").Serve(a)
+	resp.AssertStatus(t, 503)
+	assert.Equal(t, "60", resp.Header.Get("Retry-After"))
+}
+
+func TestMemoryRateLimitStoreExpiry(t *testing.T) {
+	s := NewMemoryRateLimitStore()
+	s.Update("a", time.Millisecond, func(state []byte) []byte {
+		assert.Nil(t, state)
+		return []byte("x")
+	})
+	s.Update("a", time.Millisecond, func(state []byte) []byte {
+		assert.Equal(t, []byte("x"), state)
+		return state
+	})
+
+	time.Sleep(5 * time.Millisecond)
+	s.lastSweep = time.Time{}
+	s.Update("b", time.Minute, func(state []byte) []byte { return nil })
+	_, ok := s.entries["a"]
+	assert.False(t, ok)
+}
@@ -0,0 +1,290 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+var clientKey private
+
+// RealIPOptions controls the behaviour of the RealIP middleware.
+type RealIPOptions struct {
+	// TrustedProxies lists the IP addresses and CIDR ranges (e.g.
+	// "10.0.0.0/8") of the proxies in front of the server.  Forwarding
+	// headers are only believed when they were added by a trusted proxy.
+	TrustedProxies []string
+
+	// Header is the forwarding header that the trusted proxies set: one of
+	// "Forwarded" (RFC 7239), "X-Forwarded-For" or "X-Real-IP".  Only that
+	// header is used; the others may have been sent by the client, so they
+	// are ignored.  X-Forwarded-For is used along with X-Forwarded-Proto and
+	// X-Forwarded-Host.  Defaults to "X-Forwarded-For".
+	Header string
+
+	// RewriteRemoteAddr replaces r.RemoteAddr with the client's address, for
+	// the benefit of code that doesn't know about ClientIP.
+	RewriteRemoteAddr bool
+}
+
+// clientInfo is what RealIP stores in the context.
+type clientInfo struct {
+	ip, port, scheme, host string
+}
+
+// RealIP creates a middleware that works out the real address of the client,
+// and the scheme and host that it used, from the header named by the Header
+// option, as added by trusted proxies.
+//
+// The forwarding chain is followed backwards from the server, and the client
+// is the first address that isn't a trusted proxy, so a client can't spoof its
+// address by sending the headers itself.  Requests that don't come from a
+// trusted proxy are taken at face value.
+//
+// The results are available with ClientIP, ClientScheme and ClientHost.  It
+// panics if a trusted proxy is not a valid IP address or CIDR range, or if
+// Header is not one of the supported headers.
+func RealIP(opts RealIPOptions) func(*context.Context, http.Handler) http.Handler {
+	if opts.Header == "" {
+		opts.Header = "X-Forwarded-For"
+	}
+	header := http.CanonicalHeaderKey(opts.Header)
+	switch header {
+	case "Forwarded", "X-Forwarded-For", "X-Real-Ip":
+	default:
+		panic("middleware: unsupported RealIP header: " + opts.Header)
+	}
+
+	var trusted []*net.IPNet
+	for _, s := range opts.TrustedProxies {
+		if !strings.Contains(s, "/") {
+			if strings.Contains(s, ":") {
+				s += "/128"
+			} else {
+				s += "/32"
+			}
+		}
+		_, ipnet, err := net.ParseCIDR(s)
+		if err != nil {
+			panic("middleware: invalid trusted proxy: " + err.Error())
+		}
+		trusted = append(trusted, ipnet)
+	}
+
+	isTrusted := func(ip net.IP) bool {
+		for _, ipnet := range trusted {
+			if ipnet.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	middlewareFunc := func(ctx *context.Context, h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			info := resolveClient(r, header, isTrusted)
+			*ctx = context.WithValue(*ctx, &clientKey, info)
+
+			if opts.RewriteRemoteAddr {
+				r.RemoteAddr = net.JoinHostPort(info.ip, info.port)
+			}
+			h.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+
+	return middlewareFunc
+}
+
+// forwardedHop is one hop of a forwarding chain, as described by a proxy.
+type forwardedHop struct {
+	addr, proto, host string
+}
+
+func resolveClient(r *http.Request, header string, isTrusted func(net.IP) bool) *clientInfo {
+	info := &clientInfo{scheme: "http", host: r.Host}
+	if r.TLS != nil {
+		info.scheme = "https"
+	}
+
+	info.ip, info.port = splitAddr(r.RemoteAddr)
+	peer := net.ParseIP(info.ip)
+	if peer != nil && isTrusted(peer) {
+		followHops(info, forwardedHops(r.Header, header), isTrusted)
+	}
+
+	if info.port == "" {
+		info.port = "0"
+	}
+	return info
+}
+
+// followHops walks back along the forwarding chain from the proxy nearest to
+// us.  Each hop was added by a proxy that we trust, until we reach one that we
+// don't, which is the client.
+func followHops(info *clientInfo, hops []forwardedHop, isTrusted func(net.IP) bool) {
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip, port := splitAddr(hops[i].addr)
+		addr := net.ParseIP(ip)
+		if addr == nil {
+			// Obfuscated or unknown; the last proxy we trust is the best
+			// we can do.
+			return
+		}
+
+		info.ip, info.port = addr.String(), port
+		if hops[i].proto != "" {
+			info.scheme = strings.ToLower(hops[i].proto)
+		}
+		if hops[i].host != "" {
+			info.host = hops[i].host
+		}
+
+		if !isTrusted(addr) {
+			return
+		}
+	}
+}
+
+// forwardedHops parses the given forwarding header (in canonical form) into a
+// list of hops, from the client to the nearest proxy.
+func forwardedHops(hdr http.Header, header string) []forwardedHop {
+	switch header {
+	case "Forwarded":
+		return parseForwarded(strings.Join(hdr.Values("Forwarded"), ","))
+
+	case "X-Forwarded-For":
+		addrs := splitList(strings.Join(hdr.Values("X-Forwarded-For"), ","))
+		protos := splitList(strings.Join(hdr.Values("X-Forwarded-Proto"), ","))
+		hosts := splitList(strings.Join(hdr.Values("X-Forwarded-Host"), ","))
+
+		hops := make([]forwardedHop, len(addrs))
+		for i, addr := range addrs {
+			hops[i].addr = addr
+			hops[i].proto = alignedValue(protos, i, len(addrs))
+			hops[i].host = alignedValue(hosts, i, len(addrs))
+		}
+		return hops
+
+	case "X-Real-Ip":
+		if ip := strings.TrimSpace(hdr.Get("X-Real-IP")); ip != "" {
+			return []forwardedHop{{addr: ip}}
+		}
+	}
+	return nil
+}
+
+// alignedValue returns the value from a X-Forwarded-Proto or -Host list for
+// the i'th of n hops.  If each proxy appended a value, the lists line up;
+// otherwise the value was set by the nearest proxy that set one.
+func alignedValue(values []string, i, n int) string {
+	if len(values) == n {
+		return values[i]
+	}
+	if len(values) > 0 {
+		return values[len(values)-1]
+	}
+	return ""
+}
+
+func splitList(s string) []string {
+	var ret []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			ret = append(ret, part)
+		}
+	}
+	return ret
+}
+
+// parseForwarded parses a RFC 7239 Forwarded header, e.g.
+//
+//	for=192.0.2.60;proto=http;by=203.0.113.43, for="[2001:db8::1]:4711"
+func parseForwarded(header string) []forwardedHop {
+	var hops []forwardedHop
+	for _, element := range splitQuoted(header, ',') {
+		var hop forwardedHop
+		for _, pair := range splitQuoted(element, ';') {
+			i := strings.Index(pair, "=")
+			if i < 0 {
+				continue
+			}
+			key := strings.ToLower(strings.TrimSpace(pair[:i]))
+			value := strings.TrimSpace(pair[i+1:])
+			if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+				value = strings.Replace(value[1:len(value)-1], `\`, "", -1)
+			}
+
+			switch key {
+			case "for":
+				hop.addr = value
+			case "proto":
+				hop.proto = value
+			case "host":
+				hop.host = value
+			}
+		}
+		hops = append(hops, hop)
+	}
+	return hops
+}
+
+// splitQuoted splits s on sep, except where sep is within double quotes.
+func splitQuoted(s string, sep byte) []string {
+	var ret []string
+	inQuotes, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && inQuotes:
+			i++
+		case s[i] == '"':
+			inQuotes = !inQuotes
+		case s[i] == sep && !inQuotes:
+			ret = append(ret, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(ret, s[start:])
+}
+
+// splitAddr splits an address that may or may not have a port, and may have
+// a bracketed IPv6 host, into its host and port.
+func splitAddr(addr string) (string, string) {
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		return host, port
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]"), ""
+}
+
+// ClientIP returns the client's IP address, as determined by RealIP, from the
+// given context.  Returns the empty string if the RealIP middleware was not
+// used.
+func ClientIP(ctx context.Context) string {
+	if info, ok := ctx.Value(&clientKey).(*clientInfo); ok {
+		return info.ip
+	}
+	return ""
+}
+
+// ClientScheme returns the scheme ("http" or "https") that the client used,
+// as determined by RealIP, from the given context.  Returns the empty string
+// if the RealIP middleware was not used.
+func ClientScheme(ctx context.Context) string {
+	if info, ok := ctx.Value(&clientKey).(*clientInfo); ok {
+		return info.scheme
+	}
+	return ""
+}
+
+// ClientHost returns the host that the client requested, as determined by
+// RealIP, from the given context.  Returns the empty string if the RealIP
+// middleware was not used.
+func ClientHost(ctx context.Context) string {
+	if info, ok := ctx.Value(&clientKey).(*clientInfo); ok {
+		return info.host
+	}
+	return ""
+}
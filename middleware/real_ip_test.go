@@ -0,0 +1,191 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf"
+	"github.com/andrew-d/wolf/wolftest"
+)
+
+type realIPResult struct {
+	ip, scheme, host, remoteAddr string
+}
+
+func TestRealIP(t *testing.T) {
+	proxies := []string{"10.0.0.0/8", "2001:db8:ffff::1"}
+
+	tests := []struct {
+		name       string
+		header     string
+		remoteAddr string
+		hdrs       map[string][]string
+		expected   realIPResult
+	}{
+		{
+			"untrusted peer's headers are ignored",
+			"",
+			"198.51.100.7:5000",
+			map[string][]string{"X-Forwarded-For": {"192.0.2.1"}, "X-Forwarded-Proto": {"https"}},
+			realIPResult{"198.51.100.7", "http", "app.internal", "198.51.100.7:5000"},
+		},
+		{
+			"x-forwarded-for",
+			"",
+			"10.0.0.1:5000",
+			map[string][]string{
+				"X-Forwarded-For":   {"192.0.2.1"},
+				"X-Forwarded-Proto": {"https"},
+				"X-Forwarded-Host":  {"example.com"},
+			},
+			realIPResult{"192.0.2.1", "https", "example.com", "10.0.0.1:5000"},
+		},
+		{
+			"spoofed entries before the client are skipped",
+			"",
+			"10.0.0.1:5000",
+			map[string][]string{
+				"X-Forwarded-For":   {"1.2.3.4, 192.0.2.1", "10.0.0.2"},
+				"X-Forwarded-Proto": {"https"},
+			},
+			realIPResult{"192.0.2.1", "https", "app.internal", "10.0.0.1:5000"},
+		},
+		{
+			"all hops trusted",
+			"",
+			"10.0.0.1:5000",
+			map[string][]string{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}},
+			realIPResult{"10.0.0.3", "http", "app.internal", "10.0.0.1:5000"},
+		},
+		{
+			"a spoofed forwarded header is ignored",
+			"",
+			"10.0.0.1:5000",
+			map[string][]string{
+				"Forwarded":       {"for=1.2.3.4"},
+				"X-Real-Ip":       {"1.2.3.4"},
+				"X-Forwarded-For": {"203.0.113.9"},
+			},
+			realIPResult{"203.0.113.9", "http", "app.internal", "10.0.0.1:5000"},
+		},
+		{
+			"x-real-ip",
+			"X-Real-IP",
+			"[2001:db8:ffff::1]:5000",
+			map[string][]string{"X-Real-Ip": {"192.0.2.9"}},
+			realIPResult{"192.0.2.9", "http", "app.internal", "[2001:db8:ffff::1]:5000"},
+		},
+		{
+			"forwarded",
+			"Forwarded",
+			"10.0.0.1:5000",
+			map[string][]string{"Forwarded": {
+				`for="[2001:db8::7]:4711";proto=https;host="example.com", for=10.0.0.2;proto=http`,
+			}},
+			realIPResult{"2001:db8::7", "https", "example.com", "10.0.0.1:5000"},
+		},
+		{
+			"a spoofed x-forwarded-for header is ignored, and unknown hops stop the search",
+			"Forwarded",
+			"10.0.0.1:5000",
+			map[string][]string{
+				"Forwarded":       {`for=unknown, for=10.0.0.2`},
+				"X-Forwarded-For": {"192.0.2.1"},
+			},
+			realIPResult{"10.0.0.2", "http", "app.internal", "10.0.0.1:5000"},
+		},
+		{
+			"a missing header leaves the peer",
+			"Forwarded",
+			"10.0.0.1:5000",
+			map[string][]string{"X-Forwarded-For": {"192.0.2.1"}},
+			realIPResult{"10.0.0.1", "http", "app.internal", "10.0.0.1:5000"},
+		},
+	}
+	for _, test := range tests {
+		a := wolf.New()
+		a.Use(RealIP(RealIPOptions{TrustedProxies: proxies, Header: test.header}))
+
+		var res realIPResult
+		a.Get("/", func(c context.Context, w http.ResponseWriter, r *http.Request) {
+			res = realIPResult{ClientIP(c), ClientScheme(c), ClientHost(c), r.RemoteAddr}
+		})
+
+		req := wolftest.NewRequest("GET", "http://app.internal/").WithRemoteAddr(test.remoteAddr)
+		for k, values := range test.hdrs {
+			for _, v := range values {
+				req.WithHeader(k, v)
+			}
+		}
+		req.Serve(a).AssertStatus(t, 200)
+		assert.Equal(t, test.expected, res, test.name)
+	}
+}
+
+func TestRealIPRewrite(t *testing.T) {
+	var remoteAddr string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		remoteAddr = r.RemoteAddr
+	}
+
+	a := wolf.New()
+	a.Use(RealIP(RealIPOptions{TrustedProxies: []string{"10.0.0.1"}, RewriteRemoteAddr: true}))
+	a.Get("/", handler)
+	wolftest.NewRequest("GET", "/").
+		WithRemoteAddr("10.0.0.1:5000").
+		WithHeader("X-Forwarded-For", "2001:db8::1").
+		Serve(a)
+	assert.Equal(t, "[2001:db8::1]:0", remoteAddr)
+
+	a = wolf.New()
+	a.Use(RealIP(RealIPOptions{TrustedProxies: []string{"10.0.0.1"}, RewriteRemoteAddr: true, Header: "Forwarded"}))
+	a.Get("/", handler)
+	wolftest.NewRequest("GET", "/").
+		WithRemoteAddr("10.0.0.1:5000").
+		WithHeader("Forwarded", `for="192.0.2.1:4711"`).
+		Serve(a)
+	assert.Equal(t, "192.0.2.1:4711", remoteAddr)
+}
+
+func TestRealIPInvalidOptions(t *testing.T) {
+	assert.Panics(t, func() {
+		RealIP(RealIPOptions{TrustedProxies: []string{"not an ip"}})
+	})
+	assert.Panics(t, func() {
+		RealIP(RealIPOptions{Header: "X-Client-IP"})
+	})
+}
+
+// Test that the rate limiter and logger use the real address.
+func TestRealIPUsers(t *testing.T) {
+	var buf bytes.Buffer
+	a := wolf.New()
+	a.Use(CustomLogger(LoggerOptions{Sink: NewWriterSink(&buf, LogfmtFormat)}))
+	a.Use(RealIP(RealIPOptions{TrustedProxies: []string{"10.0.0.0/8"}}))
+	a.Use(RateLimit(RateLimitOptions{Algorithm: TokenBucket(1, time.Minute, 1)}))
+	a.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+
+	do := func(client string) int {
+		return wolftest.NewRequest("GET", "/").
+			WithRemoteAddr("10.0.0.1:5000").
+			WithHeader("X-Forwarded-For", client).
+			Serve(a).Code
+	}
+
+	assert.Equal(t, 200, do("192.0.2.1"))
+	assert.Equal(t, 200, do("192.0.2.2"))
+	assert.Equal(t, 429, do("192.0.2.1"))
+	assert.Contains(t, buf.String(), "remote_addr=192.0.2.2")
+}
+
+func TestClientInfoMissing(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, "", ClientIP(ctx))
+	assert.Equal(t, "", ClientScheme(ctx))
+	assert.Equal(t, "", ClientHost(ctx))
+}
@@ -2,11 +2,14 @@ package middleware
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"html"
 	"log"
 	"net/http"
 	"os"
 	"runtime/debug"
+	"strings"
 
 	"golang.org/x/net/context"
 )
@@ -22,6 +25,10 @@ type RecoverInformation struct {
 	// RequestID is the ID of this request.  It may be empty if the corresponding
 	// middleware was not included.
 	RequestID string
+
+	// HeadersSent is true if the response's headers had already been sent
+	// when the panic happened, in which case it's too late to send an error.
+	HeadersSent bool
 }
 
 // RecoverFunc is the function type for a callback that can handle recovers.
@@ -29,7 +36,11 @@ type RecoverFunc func(w http.ResponseWriter, r *http.Request, info RecoverInform
 
 // Recoverer is a middleware that recovers from panics, prints the panic (and
 // a backtrace), and then returns a HTTP 500 (Internal Server Error) status to
-// the client, if possible.
+// the client.  The error is sent as an RFC 7807 application/problem+json
+// document or as a HTML page if the client's Accept header asks for one, and
+// as plain text otherwise.  Headers that were already set to describe the
+// response body, such as Content-Length, are discarded.  If the response had already started, it is aborted with
+// http.ErrAbortHandler instead.
 //
 // Recoverer will also include the request ID if one is provided.
 func Recoverer(ctx *context.Context, h http.Handler) http.Handler {
@@ -39,23 +50,36 @@ func Recoverer(ctx *context.Context, h http.Handler) http.Handler {
 // CustomRecoverer creates a middleware that recovers from panics, as with
 // Recoverer, but passes information about the panic to a user-defined function
 // that can take whatever action is necessary.
+//
+// Panics with http.ErrAbortHandler are not recovered, so that net/http can
+// abort the response as intended.
 func CustomRecoverer(cb RecoverFunc) func(*context.Context, http.Handler) http.Handler {
 	middlewareFunc := func(ctx *context.Context, h http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
 			requestId := GetReqID(*ctx)
 
+			lw, ok := w.(WriterProxy)
+			if !ok {
+				lw = WrapWriter(w)
+			}
+
 			defer func() {
 				if err := recover(); err != nil {
+					if err == http.ErrAbortHandler {
+						panic(err)
+					}
+
 					info := RecoverInformation{
-						Error:     err,
-						Stack:     debug.Stack(),
-						RequestID: requestId,
+						Error:       err,
+						Stack:       debug.Stack(),
+						RequestID:   requestId,
+						HeadersSent: lw.HeadersSent(),
 					}
-					cb(w, r, info)
+					cb(lw, r, info)
 				}
 			}()
 
-			h.ServeHTTP(w, r)
+			h.ServeHTTP(lw, r)
 		}
 
 		return http.HandlerFunc(fn)
@@ -64,7 +88,8 @@ func CustomRecoverer(cb RecoverFunc) func(*context.Context, http.Handler) http.H
 	return middlewareFunc
 }
 
-// The default RecoverFunc just prints to the screen
+// The default RecoverFunc prints to the screen, and sends an error to the
+// client in the format that it prefers.
 func defaultRecoverFunc(w http.ResponseWriter, r *http.Request, info RecoverInformation) {
 	var buf bytes.Buffer
 
@@ -74,11 +99,119 @@ func defaultRecoverFunc(w http.ResponseWriter, r *http.Request, info RecoverInfo
 	fmt.Fprintf(&buf, "panic: %+v", info.Error)
 
 	// Print the error to the screen
-	log.Printf(buf.String())
+	log.Print(buf.String())
 
 	// Print the stack.
 	os.Stderr.Write(info.Stack)
 
-	// Return an error
-	http.Error(w, http.StatusText(500), 500)
+	writeRecoverError(w, r, info)
+}
+
+// bodyHeaders are the response headers that describe the response body.
+var bodyHeaders = []string{
+	"Content-Length",
+	"Content-Encoding",
+	"Content-Type",
+	"Content-Disposition",
+	"Content-Range",
+	"ETag",
+	"Last-Modified",
+}
+
+// writeRecoverError sends an error to the client in the format that it
+// prefers.  If part of the response has already gone out, it's too late for
+// that, so the response is aborted instead, which tells the client that it is
+// incomplete.
+func writeRecoverError(w http.ResponseWriter, r *http.Request, info RecoverInformation) {
+	if info.HeadersSent {
+		panic(http.ErrAbortHandler)
+	}
+
+	// Headers that describe the body that won't be sent don't apply to this
+	// one.  Others, such as those set by RequestID or CORS, still do.
+	hdr := w.Header()
+	for _, k := range bodyHeaders {
+		hdr.Del(k)
+	}
+	hdr.Set("X-Content-Type-Options", "nosniff")
+	addVary(hdr, "Accept")
+
+	switch negotiateErrorType(r.Header.Get("Accept")) {
+	case "application/problem+json":
+		hdr.Set("Content-Type", "application/problem+json")
+		w.WriteHeader(500)
+		json.NewEncoder(w).Encode(problemDetails{
+			Type:      "about:blank",
+			Title:     http.StatusText(500),
+			Status:    500,
+			RequestID: info.RequestID,
+		})
+
+	case "text/html":
+		hdr.Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(500)
+		fmt.Fprintf(w, "<!DOCTYPE html>\n<html>\n<head><title>500 %[1]s</title></head>\n"+
+			"<body>\n<h1>%[1]s</h1>\n", http.StatusText(500))
+		if info.RequestID != "" {
+			fmt.Fprintf(w, "<p>Request ID: <code>%s</code></p>\n", html.EscapeString(info.RequestID))
+		}
+		fmt.Fprint(w, "</body>\n</html>\n")
+
+	default:
+		hdr.Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		fmt.Fprintln(w, http.StatusText(500))
+		if info.RequestID != "" {
+			fmt.Fprintf(w, "Request ID: %s\n", info.RequestID)
+		}
+	}
+}
+
+// problemDetails is an RFC 7807 problem details object.
+type problemDetails struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// negotiateErrorType picks the type of error response to send from an Accept
+// header: "application/problem+json", "text/html" or "text/plain".  Plain text
+// is used when the client has no preference.
+func negotiateErrorType(header string) string {
+	if header == "" {
+		return "text/plain"
+	}
+
+	accepts := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		name, q := parseQuality(part)
+		accepts[name] = q
+	}
+
+	quality := func(mediaType string) float64 {
+		if q, ok := accepts[mediaType]; ok {
+			return q
+		}
+		if q, ok := accepts[mediaType[:strings.Index(mediaType, "/")]+"/*"]; ok {
+			return q
+		}
+		if q, ok := accepts["*/*"]; ok {
+			return q
+		}
+		return 0
+	}
+
+	best, bestQ := "text/plain", quality("text/plain")
+	jsonQ := quality("application/problem+json")
+	if q := quality("application/json"); q > jsonQ {
+		jsonQ = q
+	}
+	if jsonQ > bestQ {
+		best, bestQ = "application/problem+json", jsonQ
+	}
+	if q := quality("text/html"); q > bestQ {
+		best = "text/html"
+	}
+	return best
 }
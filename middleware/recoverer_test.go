@@ -3,12 +3,14 @@ package middleware
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/net/context"
 
 	"github.com/andrew-d/wolf"
+	"github.com/andrew-d/wolf/wolftest"
 )
 
 // Test that the Recoverer will recover from panics
@@ -70,3 +72,123 @@ func TestCustomRecoverer(t *testing.T) {
 
 	assert.Equal(t, "foo bar", info.Error)
 }
+
+func TestRecovererNegotiation(t *testing.T) {
+	a := wolf.New()
+	a.Use(CustomRequestID(RequestIDOptions{TrustIncoming: true}))
+	a.Use(Recoverer)
+	a.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "10")
+		w.Header().Set("Content-Disposition", "attachment")
+		panic("foo bar")
+	})
+
+	resp := wolftest.NewRequest("GET", "/").WithHeader("X-Request-ID", "req-1").Serve(a)
+	resp.AssertStatus(t, 500)
+	assert.Equal(t, "text/plain; charset=utf-8", resp.Header.Get("Content-Type"))
+	resp.AssertBody(t, "Internal Server Error\nRequest ID: req-1\n")
+	assert.Equal(t, "", resp.Header.Get("Content-Length"))
+	assert.Equal(t, "", resp.Header.Get("Content-Disposition"))
+	assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
+	assert.Equal(t, "Accept", resp.Header.Get("Vary"))
+
+	resp = wolftest.NewRequest("GET", "/").
+		WithHeader("X-Request-ID", "req-1").
+		WithHeader("Accept", "application/json").
+		Serve(a)
+	resp.AssertStatus(t, 500)
+	assert.Equal(t, "application/problem+json", resp.Header.Get("Content-Type"))
+	resp.AssertJSON(t, map[string]interface{}{
+		"type":       "about:blank",
+		"title":      "Internal Server Error",
+		"status":     500,
+		"request_id": "req-1",
+	})
+
+	resp = wolftest.NewRequest("GET", "/").
+		WithHeader("X-Request-ID", "req-1").
+		WithHeader("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8").
+		Serve(a)
+	resp.AssertStatus(t, 500)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	resp.AssertBodyContains(t, "<h1>Internal Server Error</h1>")
+	resp.AssertBodyContains(t, "<code>req-1</code>")
+}
+
+// Test that headers set by outer middleware survive a panic.
+func TestRecovererKeepsHeaders(t *testing.T) {
+	a := wolf.New()
+	a.Use(RequestID)
+	a.Use(CORS(CORSOptions{AllowedOrigins: []string{"https://example.com"}}))
+	a.Use(Recoverer)
+	a.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"abc"`)
+		panic("foo bar")
+	})
+
+	resp := wolftest.NewRequest("GET", "/").WithHeader("Origin", "https://example.com").Serve(a)
+	resp.AssertStatus(t, 500)
+	assert.NotEqual(t, "", resp.Header.Get("X-Request-ID"))
+	resp.AssertBodyContains(t, resp.Header.Get("X-Request-ID"))
+	assert.Equal(t, "https://example.com", resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, strings.Join(resp.Header["Vary"], ", "), "Origin")
+	assert.Contains(t, strings.Join(resp.Header["Vary"], ", "), "Accept")
+	assert.Equal(t, "", resp.Header.Get("ETag"))
+}
+
+func TestNegotiateErrorType(t *testing.T) {
+	tests := []struct {
+		accept, expected string
+	}{
+		{"", "text/plain"},
+		{"*/*", "text/plain"},
+		{"image/png", "text/plain"},
+		{"application/problem+json", "application/problem+json"},
+		{"application/*", "application/problem+json"},
+		{"text/html;q=0.5, application/json", "application/problem+json"},
+		{"text/*", "text/plain"},
+		{"text/html, text/plain;q=0.5", "text/html"},
+		{"TEXT/HTML", "text/html"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, negotiateErrorType(test.accept), test.accept)
+	}
+}
+
+// Test that the response is aborted if it has already started.
+func TestRecovererHeadersSent(t *testing.T) {
+	var info RecoverInformation
+	a := wolf.New()
+	a.Use(CustomRecoverer(func(w http.ResponseWriter, r *http.Request, i RecoverInformation) {
+		info = i
+		defaultRecoverFunc(w, r, i)
+	}))
+	a.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(202)
+		w.Write([]byte("partial"))
+		panic("foo bar")
+	})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/", nil)
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		a.ServeHTTP(w, r)
+	})
+
+	assert.True(t, info.HeadersSent)
+	assert.Equal(t, 202, w.Code)
+	assert.Equal(t, "partial", w.Body.String())
+}
+
+func TestRecovererAbortHandler(t *testing.T) {
+	a := wolf.New()
+	a.Use(Recoverer)
+	a.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		a.ServeHTTP(httptest.NewRecorder(), r)
+	})
+}
@@ -3,11 +3,13 @@ package middleware
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/binary"
 	"fmt"
 	"net/http"
 	"os"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	"golang.org/x/net/context"
 )
@@ -35,30 +37,149 @@ func init() {
 	prefix = fmt.Sprintf("%s/%s", hostname, b64[0:10])
 }
 
+// DefaultRequestIDMaxLength is the longest incoming request ID that is
+// accepted, unless RequestIDOptions.MaxLength says otherwise.
+const DefaultRequestIDMaxLength = 128
+
+// RequestIDOptions controls the behaviour of the CustomRequestID middleware.
+type RequestIDOptions struct {
+	// Generator creates the ID for a request.  Defaults to CounterID; UUIDv4
+	// and ULID can be used instead.
+	Generator func() string
+
+	// Header is the response header that the ID is sent in, and the request
+	// header that it is accepted from.  Defaults to "X-Request-ID".
+	Header string
+
+	// TrustIncoming uses the ID from the request's header, if there is a
+	// valid one, instead of generating a new ID.  Enable it when the service
+	// is behind others that set the header, so that a request can be followed
+	// through all of them.
+	TrustIncoming bool
+
+	// MaxLength is the longest incoming ID that is accepted.  Defaults to
+	// DefaultRequestIDMaxLength.
+	MaxLength int
+}
+
 // RequestID is a middleware that injects a request ID into the context of each
-// request. A request ID is a string of the form "host.example.com/random-0001",
-// where "random" is a base62 random string that uniquely identifies this go
-// process, and where the last number is an atomically incremented request
-// counter.
+// request, and sends it to the client in the X-Request-ID header.  A request
+// ID is a string of the form "host.example.com/random-0001", where "random" is
+// a base62 random string that uniquely identifies this go process, and where
+// the last number is an atomically incremented request counter.
 //
 // Note: this middleware is borrowed from goji:
+//
 //	https://github.com/zenazn/goji/blob/master/web/middleware/request_id.go
 func RequestID(ctx *context.Context, h http.Handler) http.Handler {
-	fn := func(w http.ResponseWriter, r *http.Request) {
-		ctr := atomic.AddUint64(&reqid, 1)
-		id := fmt.Sprintf("%s-%06d", prefix, ctr)
+	return CustomRequestID(RequestIDOptions{})(ctx, h)
+}
+
+// CustomRequestID creates a middleware that injects a request ID into the
+// context of each request, as with RequestID, using the given options.
+//
+// Incoming IDs are only accepted if they are no longer than MaxLength, and
+// consist of ASCII letters, digits and the characters "-_.:/+=@".  Otherwise,
+// a new ID is generated.
+func CustomRequestID(opts RequestIDOptions) func(*context.Context, http.Handler) http.Handler {
+	if opts.Generator == nil {
+		opts.Generator = CounterID
+	}
+	if opts.Header == "" {
+		opts.Header = "X-Request-ID"
+	}
+	if opts.MaxLength <= 0 {
+		opts.MaxLength = DefaultRequestIDMaxLength
+	}
+
+	middlewareFunc := func(ctx *context.Context, h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			id := ""
+			if opts.TrustIncoming {
+				id = r.Header.Get(opts.Header)
+				if !validRequestID(id, opts.MaxLength) {
+					id = ""
+				}
+			}
+			if id == "" {
+				id = opts.Generator()
+			}
 
-		*ctx = context.WithValue(*ctx, requestIdKey, id)
-		h.ServeHTTP(w, r)
+			w.Header().Set(opts.Header, id)
+			*ctx = context.WithValue(*ctx, &requestIdKey, id)
+			h.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
 	}
 
-	return http.HandlerFunc(fn)
+	return middlewareFunc
+}
+
+func validRequestID(id string, maxLength int) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("-_.:/+=@", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// CounterID generates request IDs of the form "host.example.com/random-000001",
+// as described in RequestID.
+func CounterID() string {
+	ctr := atomic.AddUint64(&reqid, 1)
+	return fmt.Sprintf("%s-%06d", prefix, ctr)
+}
+
+// UUIDv4 generates random (version 4) UUIDs, such as
+// "5b0e4ad1-9f3c-4f6e-8a47-2d1c9b7e6f10".
+func UUIDv4() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID generates ULIDs, such as "01ARZ3NDEKTSV4RRFFQ69G5FAV".  They start with
+// the time in milliseconds, so they sort in the order they were created (to
+// within a millisecond).
+func ULID() string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[0:8], uint64(time.Now().UnixNano()/int64(time.Millisecond))<<16)
+	rand.Read(b[6:])
+
+	// The 128 bits are encoded five at a time, from the most significant,
+	// with two bits of zero padding at the front.
+	var out [26]byte
+	for i := range out {
+		var v byte
+		for j := 0; j < 5; j++ {
+			bit := 129 - 5*i - j // from the least significant
+			v <<= 1
+			if bit < 128 {
+				v |= b[15-bit/8] >> uint(bit%8) & 1
+			}
+		}
+		out[i] = crockford[v]
+	}
+	return string(out[:])
 }
 
 // GetReqID returns a request ID from the given context if one is present.
 // Returns the empty string if a request ID cannot be found.
 func GetReqID(ctx context.Context) string {
-	val := ctx.Value(requestIdKey)
+	val := ctx.Value(&requestIdKey)
 	if val == nil {
 		return ""
 	}
@@ -3,12 +3,15 @@ package middleware
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/net/context"
 
 	"github.com/andrew-d/wolf"
+	"github.com/andrew-d/wolf/wolftest"
 )
 
 // Test that the request ID is added and non-empty.
@@ -47,3 +50,75 @@ func TestNonExistantRequestID(t *testing.T) {
 
 	assert.True(t, run)
 }
+
+// echoReqID responds with the request's ID.
+func echoReqID(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(GetReqID(ctx)))
+}
+
+// Test that the ID is echoed to the client.
+func TestRequestIDHeader(t *testing.T) {
+	a := wolf.New()
+	a.Use(CustomRequestID(RequestIDOptions{Header: "X-Trace"}))
+	a.Get("/", echoReqID)
+
+	resp := wolftest.NewRequest("GET", "/").Serve(a)
+	id := string(resp.Body)
+	assert.True(t, strings.HasPrefix(id, prefix+"-"))
+	assert.Equal(t, id, resp.Header.Get("X-Trace"))
+}
+
+func TestRequestIDIncoming(t *testing.T) {
+	// Incoming IDs are ignored by default.
+	a := wolf.New()
+	a.Use(RequestID)
+	a.Get("/", echoReqID)
+	resp := wolftest.NewRequest("GET", "/").WithHeader("X-Request-ID", "upstream-1").Serve(a)
+	assert.NotEqual(t, "upstream-1", string(resp.Body))
+
+	a = wolf.New()
+	a.Use(CustomRequestID(RequestIDOptions{TrustIncoming: true, MaxLength: 16}))
+	a.Get("/", echoReqID)
+
+	tests := []struct {
+		incoming string
+		accepted bool
+	}{
+		{"upstream-1", true},
+		{"host.example/a:b+c=@_", false}, // too long
+		{"a/b:c+d=e@f_g.h", true},
+		{"has space", false},
+		{"new\nline", false},
+		{"<script>", false},
+	}
+	for _, test := range tests {
+		resp := wolftest.NewRequest("GET", "/").WithHeader("X-Request-ID", test.incoming).Serve(a)
+		id := string(resp.Body)
+		assert.Equal(t, test.accepted, id == test.incoming, test.incoming)
+		assert.Equal(t, id, resp.Header.Get("X-Request-ID"))
+	}
+}
+
+func TestRequestIDGenerators(t *testing.T) {
+	a := wolf.New()
+	a.Use(CustomRequestID(RequestIDOptions{Generator: UUIDv4}))
+	a.Get("/", echoReqID)
+	id := string(wolftest.NewRequest("GET", "/").Serve(a).Body)
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, id)
+	assert.NotEqual(t, UUIDv4(), UUIDv4())
+
+	before := time.Now()
+	a = wolf.New()
+	a.Use(CustomRequestID(RequestIDOptions{Generator: ULID}))
+	a.Get("/", echoReqID)
+	id = string(wolftest.NewRequest("GET", "/").Serve(a).Body)
+	assert.Regexp(t, `^[0-7][0-9A-HJKMNP-TV-Z]{25}$`, id)
+	assert.NotEqual(t, ULID(), ULID())
+
+	// The first ten characters are the time in milliseconds.
+	var ms int64
+	for _, c := range id[:10] {
+		ms = ms<<5 | int64(strings.IndexRune(crockford, c))
+	}
+	assert.WithinDuration(t, before, time.Unix(0, ms*int64(time.Millisecond)), time.Second)
+}
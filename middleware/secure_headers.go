@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+var nonceKey private
+
+// NoncePlaceholder is replaced with the request's nonce wherever it appears in
+// SecureHeadersOptions.ContentSecurityPolicy.
+const NoncePlaceholder = "{nonce}"
+
+// SecureHeadersOptions controls the headers set by CustomSecureHeaders.
+// Headers whose option is empty (or false) are not sent.
+type SecureHeadersOptions struct {
+	// HSTS is the Strict-Transport-Security header.  Browsers ignore it on
+	// plain HTTP responses.
+	HSTS string
+
+	// ContentTypeNosniff sends "X-Content-Type-Options: nosniff".
+	ContentTypeNosniff bool
+
+	// FrameOptions is the X-Frame-Options header, e.g. "DENY" or
+	// "SAMEORIGIN".
+	FrameOptions string
+
+	// ReferrerPolicy is the Referrer-Policy header.
+	ReferrerPolicy string
+
+	// PermissionsPolicy is the Permissions-Policy header.
+	PermissionsPolicy string
+
+	// ContentSecurityPolicy is the Content-Security-Policy header.  Each
+	// occurrence of NoncePlaceholder is replaced with a fresh nonce for every
+	// request, which handlers get with CSPNonce.
+	ContentSecurityPolicy string
+
+	// CSPReportOnly sends the policy as Content-Security-Policy-Report-Only,
+	// so that violations are reported but not blocked.
+	CSPReportOnly bool
+}
+
+// DefaultSecureHeadersOptions are the options used by SecureHeaders.  Copy and
+// modify them to create a stricter or looser policy.
+var DefaultSecureHeadersOptions = SecureHeadersOptions{
+	HSTS:               "max-age=63072000; includeSubDomains",
+	ContentTypeNosniff: true,
+	FrameOptions:       "DENY",
+	ReferrerPolicy:     "strict-origin-when-cross-origin",
+	PermissionsPolicy:  "camera=(), geolocation=(), microphone=()",
+	ContentSecurityPolicy: "default-src 'self'; " +
+		"script-src 'self' 'nonce-" + NoncePlaceholder + "'; " +
+		"style-src 'self' 'nonce-" + NoncePlaceholder + "'; " +
+		"object-src 'none'; base-uri 'self'; frame-ancestors 'none'",
+}
+
+// SecureHeaders is a middleware that sets security-related response headers,
+// using DefaultSecureHeadersOptions.  Scripts and styles in pages must carry
+// the request's nonce (see CSPNonce) to be allowed to run.
+func SecureHeaders(ctx *context.Context, h http.Handler) http.Handler {
+	return CustomSecureHeaders(DefaultSecureHeadersOptions)(ctx, h)
+}
+
+// CustomSecureHeaders creates a middleware that sets security-related
+// response headers, as with SecureHeaders, using the given options.
+//
+// To use a different policy for a group of routes, add this middleware to
+// them with wolf.With.  Since it runs after any App-wide middleware, its
+// headers and nonce replace those set by the App's.
+func CustomSecureHeaders(opts SecureHeadersOptions) func(*context.Context, http.Handler) http.Handler {
+	cspHeader := "Content-Security-Policy"
+	if opts.CSPReportOnly {
+		cspHeader = "Content-Security-Policy-Report-Only"
+	}
+	useNonce := strings.Contains(opts.ContentSecurityPolicy, NoncePlaceholder)
+
+	middlewareFunc := func(ctx *context.Context, h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			hdr := w.Header()
+			setOrDel(hdr, "Strict-Transport-Security", opts.HSTS)
+			if opts.ContentTypeNosniff {
+				hdr.Set("X-Content-Type-Options", "nosniff")
+			} else {
+				hdr.Del("X-Content-Type-Options")
+			}
+			setOrDel(hdr, "X-Frame-Options", opts.FrameOptions)
+			setOrDel(hdr, "Referrer-Policy", opts.ReferrerPolicy)
+			setOrDel(hdr, "Permissions-Policy", opts.PermissionsPolicy)
+
+			// A policy set further out may be in the other header.
+			hdr.Del("Content-Security-Policy")
+			hdr.Del("Content-Security-Policy-Report-Only")
+
+			csp := opts.ContentSecurityPolicy
+			nonce := ""
+			if useNonce {
+				nonce = newNonce()
+				csp = strings.Replace(csp, NoncePlaceholder, nonce, -1)
+			}
+			if csp != "" {
+				hdr.Set(cspHeader, csp)
+			}
+			*ctx = context.WithValue(*ctx, &nonceKey, nonce)
+
+			h.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+
+	return middlewareFunc
+}
+
+// CSPNonce returns the nonce for the request's Content-Security-Policy from
+// the given context, for use in templates:
+//
+//	<script nonce="{{ .Nonce }}">...</script>
+//
+// Returns the empty string if the policy doesn't use a nonce, or the
+// SecureHeaders middleware was not used.
+func CSPNonce(ctx context.Context) string {
+	val := ctx.Value(&nonceKey)
+	if val == nil {
+		return ""
+	}
+	return val.(string)
+}
+
+func newNonce() string {
+	var buf [16]byte
+	rand.Read(buf[:])
+	return base64.StdEncoding.EncodeToString(buf[:])
+}
+
+func setOrDel(hdr http.Header, key, value string) {
+	if value == "" {
+		hdr.Del(key)
+	} else {
+		hdr.Set(key, value)
+	}
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf"
+)
+
+func TestSecureHeaders(t *testing.T) {
+	a := wolf.New()
+	a.Use(SecureHeaders)
+
+	var nonce string
+	a.Get("/", func(c context.Context, w http.ResponseWriter, r *http.Request) {
+		nonce = CSPNonce(c)
+	})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/", nil)
+	a.ServeHTTP(w, r)
+
+	assert.Equal(t, "max-age=63072000; includeSubDomains", w.Header().Get("Strict-Transport-Security"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "strict-origin-when-cross-origin", w.Header().Get("Referrer-Policy"))
+	assert.Equal(t, "camera=(), geolocation=(), microphone=()", w.Header().Get("Permissions-Policy"))
+
+	csp := w.Header().Get("Content-Security-Policy")
+	assert.Len(t, nonce, 24)
+	assert.Contains(t, csp, "script-src 'self' 'nonce-"+nonce+"'")
+	assert.Contains(t, csp, "style-src 'self' 'nonce-"+nonce+"'")
+	assert.NotContains(t, csp, NoncePlaceholder)
+
+	// Every request gets a new nonce.
+	first := nonce
+	a.ServeHTTP(httptest.NewRecorder(), r)
+	assert.NotEqual(t, first, nonce)
+}
+
+// Test that a group of routes can have its own policy.
+func TestSecureHeadersPerRoute(t *testing.T) {
+	a := wolf.New()
+	a.Use(SecureHeaders)
+
+	var nonce string
+	handler := func(c context.Context, w http.ResponseWriter, r *http.Request) {
+		nonce = CSPNonce(c)
+	}
+
+	embed := CustomSecureHeaders(SecureHeadersOptions{
+		ContentTypeNosniff:    true,
+		ContentSecurityPolicy: "frame-ancestors https://partner.example.com",
+		CSPReportOnly:         true,
+	})
+	a.Get("/", handler)
+	a.Get("/embed", wolf.With(handler, embed))
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/embed", nil)
+	a.ServeHTTP(w, r)
+
+	assert.Equal(t, "", nonce)
+	assert.Equal(t, "", w.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "", w.Header().Get("Strict-Transport-Security"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "", w.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, "frame-ancestors https://partner.example.com",
+		w.Header().Get("Content-Security-Policy-Report-Only"))
+
+	// Other routes keep the App's policy.
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/", nil)
+	a.ServeHTTP(w, r)
+	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+	assert.True(t, strings.Contains(w.Header().Get("Content-Security-Policy"), nonce))
+}
+
+func TestCSPNonceMissing(t *testing.T) {
+	assert.Equal(t, "", CSPNonce(context.Background()))
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// WriterSpanExporter is a SpanExporter that writes each span to an io.Writer
+// as a line of JSON.  Use it with os.Stdout to hand spans to a log collector.
+type WriterSpanExporter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+// NewWriterSpanExporter creates a WriterSpanExporter that writes to w.
+func NewWriterSpanExporter(w io.Writer) *WriterSpanExporter {
+	return &WriterSpanExporter{w: w}
+}
+
+// ExportSpan implements SpanExporter.
+func (e *WriterSpanExporter) ExportSpan(span *SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.buf.Reset()
+	json.NewEncoder(&e.buf).Encode(span)
+	e.w.Write(e.buf.Bytes())
+}
+
+// MemorySpanExporter is a SpanExporter that keeps spans in memory, for use in
+// tests.
+type MemorySpanExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+// ExportSpan implements SpanExporter.
+func (e *MemorySpanExporter) ExportSpan(span *SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, *span)
+}
+
+// Spans returns the spans that have been exported, in the order that they
+// ended.
+func (e *MemorySpanExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]SpanData(nil), e.spans...)
+}
+
+// Reset forgets the spans that have been exported.
+func (e *MemorySpanExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriterSpanExporter(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewWriterSpanExporter(&buf)
+
+	start := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	e.ExportSpan(&SpanData{
+		Name:       "GET /",
+		Kind:       SpanKindServer,
+		TraceID:    "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanID:     "00f067aa0ba902b7",
+		Start:      start,
+		End:        start.Add(time.Second),
+		Attributes: map[string]interface{}{"http.status_code": 200},
+	})
+	e.ExportSpan(&SpanData{Name: "second"})
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.JSONEq(t, `{
+			"name": "GET /",
+			"kind": "server",
+			"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736",
+			"span_id": "00f067aa0ba902b7",
+			"start": "2016-01-02T03:04:05Z",
+			"end": "2016-01-02T03:04:06Z",
+			"attributes": {"http.status_code": 200}
+		}`, lines[0])
+
+		var second SpanData
+		assert.NoError(t, json.Unmarshal([]byte(lines[1]), &second))
+		assert.Equal(t, "second", second.Name)
+	}
+}
+
+func TestMemorySpanExporter(t *testing.T) {
+	e := &MemorySpanExporter{}
+	e.ExportSpan(&SpanData{Name: "a"})
+	e.ExportSpan(&SpanData{Name: "b"})
+
+	spans := e.Spans()
+	if assert.Len(t, spans, 2) {
+		assert.Equal(t, "a", spans[0].Name)
+		assert.Equal(t, "b", spans[1].Name)
+	}
+
+	e.Reset()
+	assert.Len(t, e.Spans(), 0)
+}
@@ -0,0 +1,302 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf/internal/writerproxy"
+)
+
+// Timeout returns a middleware that sets a deadline of d on the request's
+// context.  If the handler hasn't started writing a response by the time the
+// deadline passes, a HTTP 503 (Service Unavailable) is sent to the client and
+// any further writes by the handler will fail with http.ErrHandlerTimeout.
+//
+// The handler is expected to notice that the context has been cancelled and
+// return; the request isn't finished until it does.  Timeout can be used
+// with App.Use, or on a single route with wolf.With.
+//
+// The writer passed to the handler implements the same optional interfaces
+// as the one that Timeout was given, such as http.Flusher and http.Hijacker.
+// A hijacked connection is the handler's to manage, and isn't closed at the
+// deadline, but the request's context is still cancelled then; so
+// long-lived connections such as WebSockets shouldn't use that context.
+// Trailers are sent as usual if the handler finishes in time.
+func Timeout(d time.Duration) func(*context.Context, http.Handler) http.Handler {
+	return CustomTimeout(d, http.HandlerFunc(defaultTimeoutHandler))
+}
+
+// CustomTimeout creates a middleware that acts as Timeout does, but calls the
+// given handler to write the response when the deadline passes.
+func CustomTimeout(d time.Duration, timeoutHandler http.Handler) func(*context.Context, http.Handler) http.Handler {
+	middlewareFunc := func(ctx *context.Context, h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			var cancel context.CancelFunc
+			*ctx, cancel = context.WithTimeout(*ctx, d)
+			defer cancel()
+
+			// The context may have had an earlier deadline already.
+			deadline, _ := (*ctx).Deadline()
+			tw := &timeoutWriter{
+				w:        w,
+				h:        make(http.Header),
+				r:        r,
+				handler:  timeoutHandler,
+				deadline: deadline,
+			}
+			timer := time.AfterFunc(time.Until(deadline), tw.timeout)
+			defer timer.Stop()
+
+			h.ServeHTTP(writerproxy.WrapFull(tw, w), r)
+			tw.finish()
+		}
+
+		return http.HandlerFunc(fn)
+	}
+
+	return middlewareFunc
+}
+
+func defaultTimeoutHandler(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, http.StatusText(503), 503)
+}
+
+// timeoutWriter passes writes through to the underlying ResponseWriter until
+// the request times out, after which they are discarded.  The handler has its
+// own header map, so that the timeout response can be written from another
+// goroutine while the handler is still running.
+type timeoutWriter struct {
+	w http.ResponseWriter
+	h http.Header
+
+	// Used to send the timeout response
+	r        *http.Request
+	handler  http.Handler
+	deadline time.Time
+
+	mu          sync.Mutex
+	wroteHeader bool
+	timedOut    bool
+	finished    bool
+	hijacked    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+func (tw *timeoutWriter) Write(buf []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.checkLocked() {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.hijacked {
+		return 0, http.ErrHijacked
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	return tw.w.Write(buf)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.checkLocked() || tw.wroteHeader || tw.hijacked {
+		return
+	}
+	tw.writeHeaderLocked(code)
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(code int) {
+	dst := tw.w.Header()
+	for k, v := range tw.h {
+		dst[k] = v
+	}
+	tw.wroteHeader = true
+	tw.w.WriteHeader(code)
+}
+
+// Flush implements http.Flusher, so that streaming responses still work.
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.checkLocked() || tw.hijacked {
+		return
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	if f, ok := tw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker.  Once the connection is hijacked, the
+// timeout response is no longer sent.
+func (tw *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.checkLocked() {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+	hj, ok := tw.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	conn, rw, err := hj.Hijack()
+	if err == nil {
+		tw.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// CloseNotify implements http.CloseNotifier.
+func (tw *timeoutWriter) CloseNotify() <-chan bool {
+	if cn, ok := tw.w.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	return make(chan bool)
+}
+
+// ReadFrom implements io.ReaderFrom.  The body goes through Write, so that
+// writes after the deadline still fail.
+func (tw *timeoutWriter) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(struct{ io.Writer }{tw}, r)
+}
+
+// Push implements http.Pusher.
+func (tw *timeoutWriter) Push(target string, opts *http.PushOptions) error {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.checkLocked() {
+		return http.ErrHandlerTimeout
+	}
+	if p, ok := tw.w.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// checkLocked returns whether the request has timed out.  The handler's
+// context and our timer fire independently, so a handler that notices its
+// context is done may write before the timer has run; if so, we time out
+// here instead.
+func (tw *timeoutWriter) checkLocked() bool {
+	if !tw.timedOut && !time.Now().Before(tw.deadline) {
+		tw.timeoutLocked()
+	}
+	return tw.timedOut
+}
+
+// finish is called once the handler returns.  Since it has to wait for the
+// lock, a timeout response that is being written will be complete before the
+// middleware returns.
+func (tw *timeoutWriter) finish() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	// The handler may have returned without writing anything as soon as its
+	// context was done.
+	if !tw.checkLocked() && tw.wroteHeader && !tw.hijacked {
+		tw.copyTrailersLocked()
+	}
+	tw.finished = true
+}
+
+// copyTrailersLocked copies the trailers that the handler set, which are
+// only in its own header map, to the underlying writer.
+func (tw *timeoutWriter) copyTrailersLocked() {
+	dst := tw.w.Header()
+	for _, v := range tw.h["Trailer"] {
+		for _, k := range strings.Split(v, ",") {
+			k = http.CanonicalHeaderKey(strings.TrimSpace(k))
+			if vv, ok := tw.h[k]; ok {
+				dst[k] = vv
+			}
+		}
+	}
+	for k, vv := range tw.h {
+		if strings.HasPrefix(k, http.TrailerPrefix) {
+			dst[k] = vv
+		}
+	}
+}
+
+// timeout is called when the deadline passes.
+func (tw *timeoutWriter) timeout() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.timeoutLocked()
+}
+
+// timeoutLocked marks the request as timed out.  If the handler hasn't sent
+// any headers yet, the timeout response is sent in its place.
+func (tw *timeoutWriter) timeoutLocked() {
+	if tw.finished || tw.timedOut || tw.hijacked {
+		return
+	}
+
+	tw.timedOut = true
+	if tw.wroteHeader {
+		return
+	}
+
+	// Buffer the response so that it can be sent with a Content-Length; the
+	// client can then finish reading it without waiting for the handler to
+	// return.
+	resp := &bufferedResponse{header: make(http.Header), code: http.StatusOK}
+	tw.handler.ServeHTTP(resp, tw.r)
+
+	dst := tw.w.Header()
+	for k, v := range resp.header {
+		dst[k] = v
+	}
+	dst.Set("Content-Length", strconv.Itoa(resp.body.Len()))
+	tw.w.WriteHeader(resp.code)
+	tw.w.Write(resp.body.Bytes())
+	if f, ok := tw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// bufferedResponse is a http.ResponseWriter that saves the response in
+// memory.
+type bufferedResponse struct {
+	header      http.Header
+	code        int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) Write(buf []byte) (int, error) {
+	b.wroteHeader = true
+	return b.body.Write(buf)
+}
+
+func (b *bufferedResponse) WriteHeader(code int) {
+	if !b.wroteHeader {
+		b.code = code
+		b.wroteHeader = true
+	}
+}
@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf"
+	"github.com/andrew-d/wolf/wolftest"
+)
+
+// Test that a slow handler gets a cancelled context, and the client a 503.
+func TestTimeout(t *testing.T) {
+	a := wolf.New()
+	a.Use(Timeout(10 * time.Millisecond))
+
+	var writeErr error
+	a.Get("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Handler", "yes")
+		<-ctx.Done()
+		assert.Equal(t, context.DeadlineExceeded, ctx.Err())
+
+		// This shouldn't end up in the response
+		_, writeErr = w.Write([]byte("too late"))
+	})
+
+	recorder := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/", nil)
+	assert.NoError(t, err)
+	a.ServeHTTP(recorder, r)
+
+	assert.Equal(t, 503, recorder.Code)
+	assert.Equal(t, "Service Unavailable\n", recorder.Body.String())
+	assert.Empty(t, recorder.Header().Get("X-Handler"))
+	assert.Equal(t, http.ErrHandlerTimeout, writeErr)
+}
+
+// Test that handlers that finish in time are unaffected.
+func TestTimeoutFast(t *testing.T) {
+	a := wolf.New()
+	a.Use(Timeout(time.Second))
+
+	a.Get("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		_, ok := ctx.Deadline()
+		assert.True(t, ok)
+
+		w.Header().Set("X-Handler", "yes")
+		w.WriteHeader(201)
+		w.Write([]byte("ok"))
+	})
+
+	recorder := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/", nil)
+	assert.NoError(t, err)
+	a.ServeHTTP(recorder, r)
+
+	assert.Equal(t, 201, recorder.Code)
+	assert.Equal(t, "ok", recorder.Body.String())
+	assert.Equal(t, "yes", recorder.Header().Get("X-Handler"))
+}
+
+// Test that a per-route timeout with a custom response works.
+func TestCustomTimeoutRoute(t *testing.T) {
+	a := wolf.New()
+
+	custom := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(504)
+		w.Write([]byte(`{"error":"timeout"}`))
+	})
+
+	slow := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		<-ctx.Done()
+	}
+	a.Get("/slow", wolf.With(slow, CustomTimeout(10*time.Millisecond, custom)))
+	a.Get("/other", slow)
+
+	recorder := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/slow", nil)
+	assert.NoError(t, err)
+	a.ServeHTTP(recorder, r)
+
+	assert.Equal(t, 504, recorder.Code)
+	assert.Equal(t, `{"error":"timeout"}`, recorder.Body.String())
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "19", recorder.Header().Get("Content-Length"))
+}
+
+// Test that the handler's writer keeps the underlying writer's optional
+// interfaces, and that hijacked connections aren't interrupted.
+func TestTimeoutHijack(t *testing.T) {
+	a := wolf.New()
+	a.Use(Timeout(10 * time.Millisecond))
+
+	a.Get("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		_, ok := w.(http.Pusher)
+		assert.False(t, ok)
+
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+
+		<-ctx.Done()
+		rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 6\r\nConnection: close\r\n\r\nhijack")
+		rw.Flush()
+	})
+
+	server := httptest.NewServer(a)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if assert.NoError(t, err) {
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.Equal(t, "hijack", string(body))
+	}
+
+	// A recorder can't be hijacked, so neither can the handler's writer.
+	a = wolf.New()
+	a.Use(Timeout(time.Second))
+	a.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		_, ok := w.(http.Hijacker)
+		assert.False(t, ok)
+		_, ok = w.(http.Flusher)
+		assert.True(t, ok)
+	})
+	a.ServeHTTP(httptest.NewRecorder(), wolftest.NewRequest("GET", "/").Build())
+}
+
+func TestTimeoutTrailers(t *testing.T) {
+	a := wolf.New()
+	a.Use(Timeout(time.Second))
+	a.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Write([]byte("body"))
+		w.Header().Set("X-Checksum", "abc")
+		w.Header().Set(http.TrailerPrefix+"X-Late", "def")
+	})
+
+	server := httptest.NewServer(a)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if assert.NoError(t, err) {
+		defer resp.Body.Close()
+		ioutil.ReadAll(resp.Body)
+		assert.Equal(t, "abc", resp.Trailer.Get("X-Checksum"))
+		assert.Equal(t, "def", resp.Trailer.Get("X-Late"))
+	}
+}
@@ -0,0 +1,356 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf"
+)
+
+var spanKey private
+
+// SpanKind describes the relationship between a span and its parent.
+type SpanKind string
+
+const (
+	// SpanKindServer spans cover the handling of a request by a server.
+	SpanKindServer SpanKind = "server"
+
+	// SpanKindInternal spans cover an operation within a service.
+	SpanKindInternal SpanKind = "internal"
+
+	// SpanKindClient spans cover a request to another service.
+	SpanKindClient SpanKind = "client"
+)
+
+// SpanData is a record of a finished span, as passed to a SpanExporter.
+// Trace and span IDs are lower-case hex, as in the traceparent header.
+type SpanData struct {
+	Name         string                 `json:"name"`
+	Kind         SpanKind               `json:"kind"`
+	TraceID      string                 `json:"trace_id"`
+	SpanID       string                 `json:"span_id"`
+	ParentSpanID string                 `json:"parent_span_id,omitempty"`
+	TraceState   string                 `json:"trace_state,omitempty"`
+	Start        time.Time              `json:"start"`
+	End          time.Time              `json:"end"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+
+	// Error describes why the operation failed, if it did.
+	Error string `json:"error,omitempty"`
+}
+
+// SpanExporter receives spans when they end.  ExportSpan may be called
+// concurrently from multiple goroutines.
+type SpanExporter interface {
+	ExportSpan(span *SpanData)
+}
+
+// Span is an operation that is being traced.  Its methods are safe for
+// concurrent use.  A Span that isn't sampled records nothing, but still has
+// IDs, so that they can be passed on to other services.
+type Span struct {
+	sampled  bool
+	exporter SpanExporter
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// TraceID returns the ID of the trace that the span belongs to.
+func (s *Span) TraceID() string {
+	return s.data.TraceID
+}
+
+// SpanID returns the ID of the span.
+func (s *Span) SpanID() string {
+	return s.data.SpanID
+}
+
+// Sampled returns whether the span will be exported.
+func (s *Span) Sampled() bool {
+	return s.sampled
+}
+
+// SetName changes the name of the span.
+func (s *Span) SetName(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Name = name
+}
+
+// SetAttribute records a key-value pair describing the operation.  The value
+// should be a string, number or bool.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]interface{})
+	}
+	s.data.Attributes[key] = value
+}
+
+// SetError records that the operation failed.
+func (s *Span) SetError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Error = err.Error()
+}
+
+// End finishes the span, and exports it if it was sampled.  Calls after the
+// first have no effect.
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+
+	data := s.data
+	if data.Attributes != nil {
+		data.Attributes = make(map[string]interface{}, len(s.data.Attributes))
+		for k, v := range s.data.Attributes {
+			data.Attributes[k] = v
+		}
+	}
+	s.mu.Unlock()
+
+	if s.sampled && s.exporter != nil {
+		s.exporter.ExportSpan(&data)
+	}
+}
+
+// Traceparent returns the value of the W3C traceparent header that identifies
+// this span as the parent of a request to another service.
+func (s *Span) Traceparent() string {
+	flags := "00"
+	if s.sampled {
+		flags = "01"
+	}
+	return "00-" + s.data.TraceID + "-" + s.data.SpanID + "-" + flags
+}
+
+// Inject sets the traceparent and tracestate headers of an outgoing request,
+// so that the service it goes to continues the trace:
+//
+//	req, _ := http.NewRequest("GET", "http://users.internal/42", nil)
+//	ctx, span := middleware.StartSpan(ctx, "get user")
+//	defer span.End()
+//	span.Inject(req.Header)
+func (s *Span) Inject(h http.Header) {
+	h.Set("Traceparent", s.Traceparent())
+	if s.data.TraceState != "" {
+		h.Set("Tracestate", s.data.TraceState)
+	} else {
+		h.Del("Tracestate")
+	}
+}
+
+// GetSpan returns the current span from the given context, or nil if there is
+// none.
+func GetSpan(ctx context.Context) *Span {
+	if span, ok := ctx.Value(&spanKey).(*Span); ok {
+		return span
+	}
+	return nil
+}
+
+// StartSpan starts a span with the given name as a child of the current span
+// in ctx, and returns a context containing it.  The caller must End the span.
+// If ctx has no span, the new span starts a trace that isn't sampled.
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	span := &Span{
+		data: SpanData{
+			Name:   name,
+			Kind:   SpanKindInternal,
+			SpanID: newSpanID(),
+			Start:  time.Now(),
+		},
+	}
+	if parent := GetSpan(ctx); parent != nil {
+		span.sampled = parent.sampled
+		span.exporter = parent.exporter
+		span.data.TraceID = parent.data.TraceID
+		span.data.ParentSpanID = parent.data.SpanID
+		span.data.TraceState = parent.data.TraceState
+	} else {
+		span.data.TraceID = newTraceID()
+	}
+	return context.WithValue(ctx, &spanKey, span), span
+}
+
+// TracingOptions controls the behaviour of the Tracing middleware.
+type TracingOptions struct {
+	// Exporter receives the spans of sampled requests.  It is required.
+	Exporter SpanExporter
+
+	// Sample, if set, is called for requests that start a new trace, and
+	// the trace is only recorded if it returns true.  Requests that continue
+	// a trace follow the caller's decision.  By default, every trace is
+	// recorded.
+	Sample func(r *http.Request) bool
+}
+
+// Tracing creates a middleware that starts a server span for each request,
+// which handlers get with GetSpan, and can start child spans of with
+// StartSpan.  If the request has a valid W3C traceparent header, the span
+// continues that trace, and the tracestate header is passed on.
+//
+// The span is named after the method and route pattern, e.g.
+// "GET /users/:id", and records the status of the response.  Responses with
+// a status of 500 or above, and panics, mark the span as failed.
+func Tracing(opts TracingOptions) func(*context.Context, http.Handler) http.Handler {
+	if opts.Exporter == nil {
+		panic("middleware: Tracing requires an Exporter")
+	}
+
+	middlewareFunc := func(ctx *context.Context, h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			span := &Span{
+				exporter: opts.Exporter,
+				data: SpanData{
+					Name:   r.Method,
+					Kind:   SpanKindServer,
+					SpanID: newSpanID(),
+					Start:  time.Now(),
+				},
+			}
+
+			traceID, parentID, sampled, ok := parseTraceparent(r.Header.Get("Traceparent"))
+			if ok {
+				span.data.TraceID = traceID
+				span.data.ParentSpanID = parentID
+				span.data.TraceState = strings.Join(r.Header["Tracestate"], ",")
+				span.sampled = sampled
+			} else {
+				span.data.TraceID = newTraceID()
+				span.sampled = opts.Sample == nil || opts.Sample(r)
+			}
+
+			span.SetAttribute("http.method", r.Method)
+			span.SetAttribute("http.target", r.URL.RequestURI())
+			if id := GetReqID(*ctx); id != "" {
+				span.SetAttribute("request_id", id)
+			}
+			*ctx = context.WithValue(*ctx, &spanKey, span)
+
+			lw := WrapWriter(w)
+			defer func() {
+				// A panic is passed on for a Recoverer further out to
+				// handle, but the span is ended first.  The response will
+				// be a 500 if it hasn't started yet.
+				err := recover()
+
+				status := lw.Status()
+				if status == 0 {
+					status = http.StatusOK
+					if err != nil {
+						status = http.StatusInternalServerError
+					}
+				}
+				if route := wolf.RoutePattern(*ctx); route != "" {
+					span.SetName(r.Method + " " + route)
+					span.SetAttribute("http.route", route)
+				}
+				span.SetAttribute("http.status_code", status)
+
+				span.mu.Lock()
+				if err != nil {
+					span.data.Error = fmt.Sprintf("panic: %v", err)
+				} else if status >= 500 {
+					span.data.Error = "HTTP " + strconv.Itoa(status)
+				}
+				span.mu.Unlock()
+				span.End()
+
+				if err != nil {
+					panic(err)
+				}
+			}()
+
+			h.ServeHTTP(lw, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+
+	return middlewareFunc
+}
+
+// parseTraceparent parses a W3C traceparent header, e.g.
+//
+//	00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+//
+// It returns false if the header is missing or invalid.
+func parseTraceparent(header string) (traceID, parentID string, sampled, ok bool) {
+	header = strings.TrimSpace(header)
+	if len(header) < 55 {
+		return
+	}
+
+	version := header[0:2]
+	if !isLowerHex(version) || version == "ff" {
+		return
+	}
+	// Later versions may append fields, which we don't understand.
+	if len(header) > 55 && (version == "00" || header[55] != '-') {
+		return
+	}
+	if header[2] != '-' || header[35] != '-' || header[52] != '-' {
+		return
+	}
+
+	traceID, parentID, flags := header[3:35], header[36:52], header[53:55]
+	if !isLowerHex(traceID) || !isLowerHex(parentID) || !isLowerHex(flags) {
+		return
+	}
+	if traceID == strings.Repeat("0", 32) || parentID == strings.Repeat("0", 16) {
+		return
+	}
+
+	f, _ := strconv.ParseUint(flags, 16, 8)
+	return traceID, parentID, f&1 == 1, true
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func newTraceID() string {
+	return randomHexID(16)
+}
+
+func newSpanID() string {
+	return randomHexID(8)
+}
+
+// randomHexID returns n random bytes in hex, which are not all zero, since
+// that's an invalid ID.
+func randomHexID(n int) string {
+	buf := make([]byte, n)
+	for {
+		rand.Read(buf)
+		for _, b := range buf {
+			if b != 0 {
+				return hex.EncodeToString(buf)
+			}
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf"
+	"github.com/andrew-d/wolf/wolftest"
+)
+
+func TestTracing(t *testing.T) {
+	exporter := &MemorySpanExporter{}
+	a := wolf.New()
+	a.Use(RequestID)
+	a.Use(Tracing(TracingOptions{Exporter: exporter}))
+
+	var outgoing http.Header
+	a.Get("/users/:id", func(c context.Context, w http.ResponseWriter, r *http.Request) {
+		c, span := StartSpan(c, "load user")
+		span.SetAttribute("user.id", "42")
+		span.SetError(errors.New("not cached"))
+
+		_, inner := StartSpan(c, "query")
+		outgoing = http.Header{}
+		inner.Inject(outgoing)
+		inner.End()
+
+		span.End()
+		span.End()
+	})
+
+	r, _ := http.NewRequest("GET", "/users/42?x=1", nil)
+	r.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.Header.Add("Tracestate", "vendor=a")
+	r.Header.Add("Tracestate", "other=b")
+	a.ServeHTTP(httptest.NewRecorder(), r)
+
+	spans := exporter.Spans()
+	if !assert.Len(t, spans, 3) {
+		return
+	}
+	query, load, server := spans[0], spans[1], spans[2]
+
+	assert.Equal(t, "GET /users/:id", server.Name)
+	assert.Equal(t, SpanKindServer, server.Kind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", server.ParentSpanID)
+	assert.Equal(t, "vendor=a,other=b", server.TraceState)
+	assert.Equal(t, "/users/:id", server.Attributes["http.route"])
+	assert.Equal(t, "/users/42?x=1", server.Attributes["http.target"])
+	assert.Equal(t, 200, server.Attributes["http.status_code"])
+	assert.NotEmpty(t, server.Attributes["request_id"])
+	assert.Equal(t, "", server.Error)
+	assert.False(t, server.End.Before(server.Start))
+
+	assert.Equal(t, "load user", load.Name)
+	assert.Equal(t, SpanKindInternal, load.Kind)
+	assert.Equal(t, server.TraceID, load.TraceID)
+	assert.Equal(t, server.SpanID, load.ParentSpanID)
+	assert.Equal(t, "42", load.Attributes["user.id"])
+	assert.Equal(t, "not cached", load.Error)
+
+	assert.Equal(t, load.SpanID, query.ParentSpanID)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+query.SpanID+"-01", outgoing.Get("Traceparent"))
+	assert.Equal(t, "vendor=a,other=b", outgoing.Get("Tracestate"))
+}
+
+// Test that a panic passing through Tracing marks the span as failed, and
+// still reaches a Recoverer further out.
+func TestTracingPanic(t *testing.T) {
+	exporter := &MemorySpanExporter{}
+	a := wolf.New()
+	a.Use(Recoverer)
+	a.Use(Tracing(TracingOptions{Exporter: exporter}))
+	a.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		panic("foo bar")
+	})
+
+	wolftest.NewRequest("GET", "/").Serve(a).AssertStatus(t, 500)
+
+	spans := exporter.Spans()
+	if assert.Len(t, spans, 1) {
+		assert.Equal(t, 500, spans[0].Attributes["http.status_code"])
+		assert.Equal(t, "panic: foo bar", spans[0].Error)
+		assert.Equal(t, "GET /", spans[0].Name)
+	}
+}
+
+func TestTracingSampling(t *testing.T) {
+	exporter := &MemorySpanExporter{}
+	a := wolf.New()
+	a.Use(Tracing(TracingOptions{
+		Exporter: exporter,
+		Sample:   func(r *http.Request) bool { return r.URL.Path == "/sampled" },
+	}))
+
+	var span *Span
+	handler := func(c context.Context, w http.ResponseWriter, r *http.Request) {
+		span = GetSpan(c)
+		w.WriteHeader(503)
+	}
+	a.Get("/sampled", handler)
+	a.Get("/other", handler)
+
+	do := func(path, traceparent string) {
+		r, _ := http.NewRequest("GET", path, nil)
+		if traceparent != "" {
+			r.Header.Set("Traceparent", traceparent)
+		}
+		a.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	// New traces are sampled by the Sample function.
+	do("/other", "")
+	assert.False(t, span.Sampled())
+	assert.Len(t, span.TraceID(), 32)
+	assert.Len(t, exporter.Spans(), 0)
+
+	do("/sampled", "")
+	if assert.Len(t, exporter.Spans(), 1) {
+		assert.Equal(t, "HTTP 503", exporter.Spans()[0].Error)
+		assert.Equal(t, "", exporter.Spans()[0].ParentSpanID)
+	}
+	exporter.Reset()
+
+	// The caller's decision is followed.
+	do("/sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	assert.False(t, span.Sampled())
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+span.SpanID()+"-00", span.Traceparent())
+	do("/other", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.True(t, span.Sampled())
+	assert.Len(t, exporter.Spans(), 1)
+}
+
+func TestParseTraceparent(t *testing.T) {
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+	tests := []struct {
+		header  string
+		ok      bool
+		sampled bool
+	}{
+		{"00-" + traceID + "-" + spanID + "-01", true, true},
+		{"00-" + traceID + "-" + spanID + "-00", true, false},
+		{"00-" + traceID + "-" + spanID + "-03", true, true},
+		{"cc-" + traceID + "-" + spanID + "-01-future", true, true},
+		{"", false, false},
+		{"00-" + traceID + "-" + spanID + "-01-extra", false, false},
+		{"cc-" + traceID + "-" + spanID + "-01future", false, false},
+		{"ff-" + traceID + "-" + spanID + "-01", false, false},
+		{"00-" + "4BF92F3577B34DA6A3CE929D0E0E4736" + "-" + spanID + "-01", false, false},
+		{"00-00000000000000000000000000000000-" + spanID + "-01", false, false},
+		{"00-" + traceID + "-0000000000000000-01", false, false},
+		{"00_" + traceID + "-" + spanID + "-01", false, false},
+	}
+	for _, test := range tests {
+		tid, sid, sampled, ok := parseTraceparent(test.header)
+		assert.Equal(t, test.ok, ok, test.header)
+		assert.Equal(t, test.sampled, sampled, test.header)
+		if test.ok {
+			assert.Equal(t, traceID, tid)
+			assert.Equal(t, spanID, sid)
+		}
+	}
+}
+
+// Test that spans can be used without the middleware.
+func TestStartSpanWithoutParent(t *testing.T) {
+	assert.Nil(t, GetSpan(context.Background()))
+
+	ctx, span := StartSpan(context.Background(), "orphan")
+	assert.Equal(t, span, GetSpan(ctx))
+	assert.False(t, span.Sampled())
+	assert.Len(t, span.SpanID(), 16)
+	span.SetAttribute("k", 1)
+	span.End()
+}
+
+func TestTracingRequiresExporter(t *testing.T) {
+	assert.Panics(t, func() {
+		Tracing(TracingOptions{})
+	})
+}
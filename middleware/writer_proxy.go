@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/andrew-d/wolf/internal/writerproxy"
+)
+
+// WriterProxy is a proxy around a http.ResponseWriter that records
+// information about the response as it is written.
+type WriterProxy interface {
+	http.ResponseWriter
+
+	// Status returns the HTTP status code of the response, or 0 if the
+	// headers have not been sent yet.
+	Status() int
+
+	// BytesWritten returns the number of bytes of the response body that
+	// have been written.
+	BytesWritten() int
+
+	// HeadersSent returns whether the headers of the response have been
+	// sent, after which they can no longer be changed.
+	HeadersSent() bool
+
+	// Tee causes the response body to also be written to the given
+	// io.Writer.
+	Tee(io.Writer)
+
+	// Unwrap returns the original http.ResponseWriter.  It also allows
+	// http.ResponseController to reach the original.
+	Unwrap() http.ResponseWriter
+}
+
+// WrapWriter wraps a http.ResponseWriter in a WriterProxy.  The returned value
+// implements exactly the optional interfaces that w does, out of
+// http.Flusher, http.Hijacker, http.CloseNotifier, io.ReaderFrom and
+// http.Pusher, so wrapping a writer never hides any of them.
+func WrapWriter(w http.ResponseWriter) WriterProxy {
+	return writerproxy.Wrap(w, nil)
+}
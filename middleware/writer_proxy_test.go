@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrapWriter(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	w := WrapWriter(recorder)
+
+	assert.False(t, w.HeadersSent())
+	assert.Equal(t, 0, w.Status())
+
+	var tee bytes.Buffer
+	w.Tee(&tee)
+	w.WriteHeader(404)
+	w.WriteHeader(500) // ignored by the proxy
+	w.Write([]byte("not found"))
+
+	assert.True(t, w.HeadersSent())
+	assert.Equal(t, 404, w.Status())
+	assert.Equal(t, 9, w.BytesWritten())
+	assert.Equal(t, "not found", tee.String())
+	assert.Equal(t, recorder, w.Unwrap())
+
+	// A write without WriteHeader is an implicit 200
+	w = WrapWriter(httptest.NewRecorder())
+	w.Write([]byte("ok"))
+	assert.Equal(t, 200, w.Status())
+}
+
+// fakeHTTP2Writer implements the optional interfaces of a HTTP/2 writer.
+type fakeHTTP2Writer struct {
+	*httptest.ResponseRecorder
+	pushed string
+}
+
+func (f *fakeHTTP2Writer) CloseNotify() <-chan bool { return nil }
+
+func (f *fakeHTTP2Writer) Push(target string, opts *http.PushOptions) error {
+	f.pushed = target
+	return nil
+}
+
+// hijackRecorder can flush and hijack, but not notify of closes.
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (h hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, nil
+}
+
+func TestWrapWriterInterfaces(t *testing.T) {
+	// A recorder can only flush
+	var w http.ResponseWriter = WrapWriter(httptest.NewRecorder())
+	_, ok := w.(http.Flusher)
+	assert.True(t, ok)
+	_, ok = w.(http.Hijacker)
+	assert.False(t, ok)
+
+	w = WrapWriter(hijackRecorder{httptest.NewRecorder()})
+	assert.Implements(t, (*http.Flusher)(nil), w)
+	assert.Implements(t, (*http.Hijacker)(nil), w)
+	_, ok = w.(http.CloseNotifier)
+	assert.False(t, ok)
+
+	h2 := &fakeHTTP2Writer{ResponseRecorder: httptest.NewRecorder()}
+	w = WrapWriter(h2)
+	if assert.Implements(t, (*http.Pusher)(nil), w) {
+		w.(http.Pusher).Push("/app.js", nil)
+		assert.Equal(t, "/app.js", h2.pushed)
+	}
+	assert.Implements(t, (*http.CloseNotifier)(nil), w)
+
+	// Writers from a real HTTP/1.1 server keep all of their interfaces
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		w := WrapWriter(rw)
+		assert.Implements(t, (*http.Flusher)(nil), w)
+		assert.Implements(t, (*http.CloseNotifier)(nil), w)
+		assert.Implements(t, (*io.ReaderFrom)(nil), w)
+
+		if r.URL.Path == "/hijack" {
+			var conn net.Conn
+			var buf *bufio.ReadWriter
+			conn, buf, err := w.(http.Hijacker).Hijack()
+			assert.NoError(t, err)
+			buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+			buf.Flush()
+			conn.Close()
+			return
+		}
+
+		n, err := w.(io.ReaderFrom).ReadFrom(strings.NewReader("read from"))
+		assert.NoError(t, err)
+		assert.EqualValues(t, 9, n)
+		assert.Equal(t, 9, w.BytesWritten())
+		assert.Equal(t, 200, w.Status())
+	}))
+	defer srv.Close()
+
+	for path, expected := range map[string]string{"/": "read from", "/hijack": "hijacked"} {
+		resp, err := http.Get(srv.URL + path)
+		if assert.NoError(t, err) {
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			assert.Equal(t, expected, string(body))
+		}
+	}
+}
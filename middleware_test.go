@@ -58,3 +58,41 @@ func TestMiddlewareOrder(t *testing.T) {
 	assert.True(t, run)
 	assert.Equal(t, []string{"one", "two"}, calls)
 }
+
+// Test that route middleware runs inside the App's middleware, and can see
+// and modify the route's context.
+func TestWith(t *testing.T) {
+	a := New()
+
+	var calls []string
+	a.Use(func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls = append(calls, "app")
+			h.ServeHTTP(w, r)
+		})
+	})
+
+	routeMiddleware := func(ctx *context.Context, h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			param, _ := ParamFrom(*ctx, "param")
+			calls = append(calls, "route "+param)
+			*ctx = context.WithValue(*ctx, "route", true)
+			h.ServeHTTP(w, r)
+		})
+	}
+
+	a.Get("/:param", With(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handler")
+		assert.Equal(t, true, ctx.Value("route"))
+	}, routeMiddleware))
+
+	r, err := http.NewRequest("GET", "/foo", nil)
+	assert.NoError(t, err)
+	a.ServeHTTP(httptest.NewRecorder(), r)
+
+	assert.Equal(t, []string{"app", "route foo", "handler"}, calls)
+
+	assert.Panics(t, func() {
+		With(dummyHandler{}, func(i int) int { return i + 1 })
+	})
+}
@@ -7,6 +7,14 @@ import (
 
 var paramsKey private
 
+// NewParamsContext returns a copy of ctx that contains the given route
+// parameters, exactly as the router does before calling a handler.  It is
+// mostly useful for calling handlers directly in tests; see the wolftest
+// package.
+func NewParamsContext(ctx context.Context, p httprouter.Params) context.Context {
+	return setParamsInContext(ctx, p)
+}
+
 func setParamsInContext(ctx context.Context, p httprouter.Params) context.Context {
 	// Allocate a map large enough to handle the params
 	mm := make(map[string][]string, len(p))
@@ -42,7 +50,9 @@ func ParamFrom(ctx context.Context, name string) (string, bool) {
 // this context, along with a boolean indicating whether or not the parameter
 // was given.
 func AllParamsFrom(ctx context.Context, name string) ([]string, bool) {
-	mm := ctx.Value(&paramsKey).(map[string][]string)
+	// The params won't be present if the handler wasn't called by the
+	// router, in which case the lookup on a nil map is fine.
+	mm, _ := ctx.Value(&paramsKey).(map[string][]string)
 	if l, ok := mm[name]; ok {
 		return l, true
 	}
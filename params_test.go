@@ -41,3 +41,24 @@ func TestParams(t *testing.T) {
 	_, ok = AllParamsFrom(newCtx, "notfound")
 	assert.False(t, ok)
 }
+
+// Test that looking up params in a context without any doesn't panic.
+func TestParamsMissing(t *testing.T) {
+	ctx := context.Background()
+
+	_, ok := ParamFrom(ctx, "foo")
+	assert.False(t, ok)
+
+	_, ok = AllParamsFrom(ctx, "foo")
+	assert.False(t, ok)
+}
+
+func TestNewParamsContext(t *testing.T) {
+	ctx := NewParamsContext(context.Background(), httprouter.Params{
+		{Key: "id", Value: "42"},
+	})
+
+	val, ok := ParamFrom(ctx, "id")
+	assert.True(t, ok)
+	assert.Equal(t, "42", val)
+}
@@ -0,0 +1,218 @@
+package wolf
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/context"
+)
+
+var routeKey private
+
+// Route describes a route that has been registered on an App.
+type Route struct {
+	Method string
+	Path   string
+
+	// Metadata is the metadata attached to the route's handler with
+	// WithMetadata, or nil if there is none.
+	Metadata map[string]interface{}
+
+	// Middleware lists the names of the middleware added to the route's
+	// handler with With, or nil if there is none.
+	Middleware []string
+
+	// skipMiddleware is set for routes registered with
+	// HandleWithoutMiddleware.
+	skipMiddleware bool
+}
+
+// WithMetadata returns a handler that calls h, and attaches the given
+// metadata to the routes that it is registered for.  Middleware can then look
+// up the metadata of the route that will handle a request, before routing,
+// with LookupRoute.  Keys should be namespaced to the package that uses them,
+// e.g. "csrf.exempt".
+//
+// Metadata attached to a handler that is passed to With is kept, and
+// wrapping a handler more than once merges the metadata.
+func WithMetadata(h HandlerType, metadata map[string]interface{}) Handler {
+	merged := make(map[string]interface{})
+	if mh, ok := h.(metadataHandler); ok {
+		for k, v := range mh.metadata {
+			merged[k] = v
+		}
+	}
+	for k, v := range metadata {
+		merged[k] = v
+	}
+	return metadataHandler{MakeHandler(h), merged}
+}
+
+// metadataHandler is a Handler with metadata, as returned by WithMetadata.
+type metadataHandler struct {
+	Handler
+	metadata map[string]interface{}
+}
+
+func handlerMetadata(h HandlerType) map[string]interface{} {
+	if mh, ok := h.(metadataHandler); ok {
+		return mh.metadata
+	}
+	return nil
+}
+
+func handlerMiddleware(h HandlerType) []string {
+	if mh, ok := h.(metadataHandler); ok {
+		h = mh.Handler
+	}
+	if rs, ok := h.(routeStack); ok && len(rs.stack.names) > 0 {
+		return append([]string(nil), rs.stack.names...)
+	}
+	return nil
+}
+
+// addRoute records a route in the route table.  Each route is also added to
+// a separate router, whose handles report the route they belong to, so that
+// LookupRoute can match paths in exactly the same way as the real router.
+func (a *App) addRoute(route Route) {
+	a.routesMu.Lock()
+	defer a.routesMu.Unlock()
+
+	a.routes = append(a.routes, route)
+	if route.skipMiddleware {
+		a.skipRoutes++
+	}
+	if a.index == nil {
+		a.index = httprouter.New()
+	}
+	a.index.Handle(route.Method, route.Path, func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		w.(*routeProbe).route = route
+	})
+}
+
+// routeProbe is passed to the handles in an App's index to find out which
+// route they belong to.  Its ResponseWriter methods are never called.
+type routeProbe struct {
+	http.ResponseWriter
+	route Route
+}
+
+// Routes returns all routes registered on this App, in the order that they
+// were registered.
+func (a *App) Routes() []Route {
+	a.routesMu.RLock()
+	defer a.routesMu.RUnlock()
+	return append([]Route(nil), a.routes...)
+}
+
+// AllowedMethods returns the methods that have a route matching the given
+// request path (e.g. "/users/42"), in the order that they were first
+// registered.  It returns nil if no route matches the path.
+func (a *App) AllowedMethods(path string) []string {
+	a.routesMu.RLock()
+	defer a.routesMu.RUnlock()
+
+	var ret []string
+	seen := make(map[string]bool)
+	for _, route := range a.routes {
+		if seen[route.Method] {
+			continue
+		}
+		seen[route.Method] = true
+
+		if handle, _, _ := a.router.Lookup(route.Method, path); handle != nil {
+			ret = append(ret, route.Method)
+		}
+	}
+	return ret
+}
+
+// LookupRoute returns the route that would handle a request with the given
+// method and path (e.g. "/users/42"), and whether there is one.
+func (a *App) LookupRoute(method, path string) (Route, bool) {
+	a.routesMu.RLock()
+	defer a.routesMu.RUnlock()
+	return a.lookupRoute(method, path)
+}
+
+// skipsMiddleware reports whether a request matches a route that was
+// registered with HandleWithoutMiddleware.
+func (a *App) skipsMiddleware(r *http.Request) bool {
+	a.routesMu.RLock()
+	defer a.routesMu.RUnlock()
+
+	if a.skipRoutes == 0 {
+		return false
+	}
+	route, ok := a.lookupRoute(r.Method, r.URL.Path)
+	return ok && route.skipMiddleware
+}
+
+// lookupRoute is LookupRoute without the locking.
+func (a *App) lookupRoute(method, path string) (Route, bool) {
+	if a.index == nil {
+		return Route{}, false
+	}
+	handle, _, _ := a.index.Lookup(method, path)
+	if handle == nil {
+		return Route{}, false
+	}
+
+	probe := &routeProbe{}
+	handle(probe, nil, nil)
+	return probe.route, true
+}
+
+// routeState is stored in each request's context before the middleware is
+// run, so that the router can record which route matched.  This lets
+// middleware find out about the route after the handler has returned.
+type routeState struct {
+	app     *App
+	pattern string
+}
+
+func newRouteContext(ctx context.Context, a *App) context.Context {
+	return context.WithValue(ctx, &routeKey, &routeState{app: a})
+}
+
+func setRoutePattern(ctx context.Context, pattern string) {
+	if st, ok := ctx.Value(&routeKey).(*routeState); ok {
+		st.pattern = pattern
+	}
+}
+
+// RoutePattern returns the path pattern of the route that is handling the
+// request with the given context, e.g. "/users/:id".  This is useful for
+// grouping requests in logs and metrics.
+//
+// Middleware can only get the pattern after it has called the next handler,
+// since the route has not been matched before then.  The empty string is
+// returned if no route matched.
+func RoutePattern(ctx context.Context) string {
+	if st, ok := ctx.Value(&routeKey).(*routeState); ok {
+		return st.pattern
+	}
+	return ""
+}
+
+// AllowedMethods returns the methods that the App handling the request with
+// the given context has routes for at the given path, as App.AllowedMethods
+// does.  This lets middleware that runs before routing find out about the
+// route table.
+func AllowedMethods(ctx context.Context, path string) []string {
+	if st, ok := ctx.Value(&routeKey).(*routeState); ok {
+		return st.app.AllowedMethods(path)
+	}
+	return nil
+}
+
+// LookupRoute returns the route that the App handling the request with the
+// given context would use for the given method and path, as App.LookupRoute
+// does.  Unlike RoutePattern, this works before routing, so middleware can
+// use it to find the metadata of the route that a request is for.
+func LookupRoute(ctx context.Context, method, path string) (Route, bool) {
+	if st, ok := ctx.Value(&routeKey).(*routeState); ok {
+		return st.app.LookupRoute(method, path)
+	}
+	return Route{}, false
+}
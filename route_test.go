@@ -0,0 +1,182 @@
+package wolf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestRoutePattern(t *testing.T) {
+	a := New()
+
+	var before, after string
+	a.Use(func(ctx *context.Context, h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			before = RoutePattern(*ctx)
+			h.ServeHTTP(w, r)
+			after = RoutePattern(*ctx)
+		})
+	})
+
+	var inHandler string
+	a.Get("/users/:id", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		inHandler = RoutePattern(ctx)
+	})
+
+	r, _ := http.NewRequest("GET", "/users/42", nil)
+	a.ServeHTTP(httptest.NewRecorder(), r)
+
+	assert.Equal(t, "", before)
+	assert.Equal(t, "/users/:id", inHandler)
+	assert.Equal(t, "/users/:id", after)
+
+	// Unmatched routes have no pattern
+	r, _ = http.NewRequest("GET", "/nope", nil)
+	a.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, "", after)
+
+	assert.Equal(t, "", RoutePattern(context.Background()))
+}
+
+func TestRouteTable(t *testing.T) {
+	a := New()
+
+	fn := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {}
+	a.Get("/users/:id", fn)
+	a.Put("/users/:id", fn)
+	a.Post("/users", fn)
+
+	assert.Equal(t, []Route{
+		{Method: "GET", Path: "/users/:id"},
+		{Method: "PUT", Path: "/users/:id"},
+		{Method: "POST", Path: "/users"},
+	}, a.Routes())
+
+	assert.Equal(t, []string{"GET", "PUT"}, a.AllowedMethods("/users/42"))
+	assert.Equal(t, []string{"POST"}, a.AllowedMethods("/users"))
+	assert.Nil(t, a.AllowedMethods("/nope"))
+
+	// The same is available to middleware through the context
+	var fromCtx []string
+	a.Use(func(ctx *context.Context, h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fromCtx = AllowedMethods(*ctx, r.URL.Path)
+			h.ServeHTTP(w, r)
+		})
+	})
+
+	r, _ := http.NewRequest("OPTIONS", "/users/42", nil)
+	a.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, []string{"GET", "PUT"}, fromCtx)
+	assert.Nil(t, AllowedMethods(context.Background(), "/users/42"))
+}
+
+// Test that route lookups don't wait for the App's other state, since
+// middleware does them on every request.
+func TestLookupRouteLocking(t *testing.T) {
+	a := New()
+	a.Get("/users/:id", func(w http.ResponseWriter, r *http.Request) {})
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.routesMu.RLock()
+	defer a.routesMu.RUnlock()
+
+	route, ok := a.LookupRoute("GET", "/users/42")
+	assert.True(t, ok)
+	assert.Equal(t, "/users/:id", route.Path)
+	assert.Equal(t, []string{"GET"}, a.AllowedMethods("/users/42"))
+}
+
+func TestRouteMetadata(t *testing.T) {
+	a := New()
+
+	called := false
+	fn := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		called = true
+	}
+	noop := func(ctx *context.Context, h http.Handler) http.Handler { return h }
+
+	a.Get("/users/:id", WithMetadata(fn, map[string]interface{}{"auth": "user"}))
+	a.Post("/users/:id", With(WithMetadata(fn, map[string]interface{}{"auth": "admin"}), noop))
+	a.Get("/files/*path", WithMetadata(WithMetadata(fn, map[string]interface{}{"a": 1}), map[string]interface{}{"b": 2}))
+	a.Get("/plain", fn)
+
+	route, ok := a.LookupRoute("GET", "/users/42")
+	assert.True(t, ok)
+	assert.Equal(t, Route{Method: "GET", Path: "/users/:id", Metadata: map[string]interface{}{"auth": "user"}}, route)
+
+	route, _ = a.LookupRoute("POST", "/users/42")
+	assert.Equal(t, "admin", route.Metadata["auth"])
+
+	route, _ = a.LookupRoute("GET", "/files/a/b")
+	assert.Equal(t, map[string]interface{}{"a": 1, "b": 2}, route.Metadata)
+
+	route, ok = a.LookupRoute("GET", "/plain")
+	assert.True(t, ok)
+	assert.Nil(t, route.Metadata)
+
+	_, ok = a.LookupRoute("DELETE", "/users/42")
+	assert.False(t, ok)
+	_, ok = New().LookupRoute("GET", "/")
+	assert.False(t, ok)
+
+	// Handlers with metadata still work, and middleware can find the
+	// route before routing.
+	var fromCtx Route
+	a.Use(func(ctx *context.Context, h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fromCtx, _ = LookupRoute(*ctx, r.Method, r.URL.Path)
+			h.ServeHTTP(w, r)
+		})
+	})
+
+	r, _ := http.NewRequest("POST", "/users/42", nil)
+	a.ServeHTTP(httptest.NewRecorder(), r)
+	assert.True(t, called)
+	assert.Equal(t, "/users/:id", fromCtx.Path)
+	assert.Equal(t, "admin", fromCtx.Metadata["auth"])
+
+	_, ok = LookupRoute(context.Background(), "GET", "/plain")
+	assert.False(t, ok)
+}
+
+func TestHandleWithoutMiddleware(t *testing.T) {
+	a := New()
+	a.Use(func(ctx *context.Context, h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(418)
+		})
+	})
+
+	var pattern, param string
+	a.HandleWithoutMiddleware("GET", "/debug/:name", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		pattern = RoutePattern(ctx)
+		param, _ = ParamFrom(ctx, "name")
+	})
+	a.Get("/other", func(w http.ResponseWriter, r *http.Request) {})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/debug/vars", nil)
+	a.ServeHTTP(w, r)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "/debug/:name", pattern)
+	assert.Equal(t, "vars", param)
+
+	// Other routes and methods, and unmatched paths, still go through the
+	// middleware.
+	for _, req := range [][2]string{{"GET", "/other"}, {"POST", "/debug/vars"}, {"GET", "/debug/a/b"}} {
+		w = httptest.NewRecorder()
+		r, _ = http.NewRequest(req[0], req[1], nil)
+		a.ServeHTTP(w, r)
+		assert.Equal(t, 418, w.Code, "%s %s", req[0], req[1])
+	}
+
+	route, ok := a.LookupRoute("GET", "/debug/vars")
+	assert.True(t, ok)
+	assert.Equal(t, "/debug/:name", route.Path)
+}
@@ -0,0 +1,154 @@
+package wolf
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// DefaultShutdownTimeout is the amount of time that an App will wait for
+// in-flight requests to finish if ShutdownTimeout is not set.
+const DefaultShutdownTimeout = 30 * time.Second
+
+// ErrAlreadyServing is returned by Serve and ListenAndServe if they have
+// already been called on the App.  Since requests' contexts are cancelled when
+// Serve finishes, an App can only be served once.
+var ErrAlreadyServing = errors.New("wolf: Serve has already been called on this App")
+
+// OnStart registers a function to be called by Serve before it begins
+// accepting connections.  Functions are called in the order they were
+// registered; if one returns an error, Serve closes the listener and returns
+// that error without serving any requests, and the App may be served again.
+func (a *App) OnStart(fn func() error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.onStart = append(a.onStart, fn)
+}
+
+// OnShutdown registers a function to be called when a graceful shutdown
+// begins, before the App stops accepting connections.  Functions are called in
+// the order they were registered.
+func (a *App) OnShutdown(fn func()) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.onShutdown = append(a.onShutdown, fn)
+}
+
+// ListenAndServe listens on the given TCP address and then calls Serve.
+func (a *App) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return a.Serve(l)
+}
+
+// Serve accepts connections on the given listener and serves requests with
+// this App until the process receives SIGINT or SIGTERM, or Shutdown is
+// called.
+//
+// When that happens, the App first calls any OnShutdown functions while it is
+// still accepting connections.  It then stops accepting new connections and
+// waits up to ShutdownTimeout for in-flight requests to complete.  The
+// contexts of any handlers that are still running are then cancelled, so that
+// they can notice and give up; RootContext itself is left alone.  Serve
+// returns nil if every request finished in time.
+func (a *App) Serve(l net.Listener) error {
+	a.mu.Lock()
+	if a.shutdown != nil {
+		a.mu.Unlock()
+		l.Close()
+		return ErrAlreadyServing
+	}
+
+	rootCtx, cancelRoot := context.WithCancel(a.RootContext)
+	a.serving.Store(servingContext{rootCtx})
+
+	shutdown := make(chan struct{})
+	a.shutdown = shutdown
+	onStart := a.onStart
+	a.mu.Unlock()
+
+	defer cancelRoot()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	for _, fn := range onStart {
+		if err := fn(); err != nil {
+			l.Close()
+
+			a.mu.Lock()
+			a.serving.Store(servingContext{})
+			a.shutdown = nil
+			a.mu.Unlock()
+			return err
+		}
+	}
+
+	srv := &http.Server{Handler: a}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(l)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-sigs:
+	case <-shutdown:
+	}
+
+	a.mu.Lock()
+	onShutdown := a.onShutdown
+	a.mu.Unlock()
+	for _, fn := range onShutdown {
+		fn()
+	}
+
+	timeout := a.ShutdownTimeout
+	if timeout == 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := srv.Shutdown(ctx)
+
+	// Tell any handlers that are still running to stop, and then drop their
+	// connections.
+	cancelRoot()
+	if err != nil {
+		srv.Close()
+	}
+
+	<-serveErr
+	return err
+}
+
+// Shutdown begins a graceful shutdown of an App that is being served by Serve
+// or ListenAndServe, exactly as if the process had received SIGTERM.  It
+// returns immediately; Serve returns once the shutdown is complete.  Calling
+// Shutdown on an App that has not been served does nothing.
+func (a *App) Shutdown() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.shutdown == nil {
+		return
+	}
+
+	select {
+	case <-a.shutdown:
+	default:
+		close(a.shutdown)
+	}
+}
@@ -0,0 +1,180 @@
+package wolf
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// startApp serves the App on a random local port, and returns the base URL
+// along with a channel that receives the result of Serve.
+func startApp(t *testing.T, a *App) (string, chan error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	a.OnStart(func() error {
+		close(started)
+		return nil
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- a.Serve(l)
+	}()
+	<-started
+
+	return "http://" + l.Addr().String(), done
+}
+
+// Test that a shutdown waits for in-flight requests, and runs the hooks.
+func TestServeGraceful(t *testing.T) {
+	a := New()
+
+	inHandler := make(chan struct{})
+	a.Get("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		close(inHandler)
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+
+	var hookRun bool
+	a.OnShutdown(func() {
+		hookRun = true
+	})
+
+	url, done := startApp(t, a)
+
+	respCh := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(url)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		respCh <- string(body)
+	}()
+
+	<-inHandler
+	a.Shutdown()
+
+	assert.NoError(t, <-done)
+	assert.Equal(t, "done", <-respCh)
+	assert.True(t, hookRun)
+
+	// Requests' contexts are cancelled afterwards, and the App can't be
+	// reused
+	var afterErr error
+	a.Get("/after", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		afterErr = ctx.Err()
+	})
+	r, _ := http.NewRequest("GET", "/after", nil)
+	a.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, context.Canceled, afterErr)
+	assert.NoError(t, a.RootContext.Err())
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, ErrAlreadyServing, a.Serve(l))
+}
+
+// Test that handlers that outlive the shutdown timeout see the root context
+// being cancelled.
+func TestServeTimeout(t *testing.T) {
+	a := New()
+	a.ShutdownTimeout = 20 * time.Millisecond
+
+	inHandler := make(chan struct{})
+	cancelled := make(chan struct{})
+	a.Get("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		close(inHandler)
+		<-ctx.Done()
+		close(cancelled)
+	})
+
+	url, done := startApp(t, a)
+	go http.Get(url)
+
+	<-inHandler
+	a.Shutdown()
+
+	assert.Equal(t, context.DeadlineExceeded, <-done)
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("handler context was not cancelled")
+	}
+}
+
+func TestServeSignal(t *testing.T) {
+	a := New()
+	_, done := startApp(t, a)
+
+	syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("SIGTERM did not stop the server")
+	}
+}
+
+func TestServeStartError(t *testing.T) {
+	a := New()
+	a.OnStart(func() error {
+		return errors.New("no database")
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	assert.EqualError(t, a.Serve(l), "no database")
+
+	// The App's requests aren't cancelled, and it can be served again.
+	var ctxErr error
+	a.Get("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		ctxErr = ctx.Err()
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+	a.ServeHTTP(httptest.NewRecorder(), r)
+	assert.NoError(t, ctxErr)
+
+	l, err = net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	assert.EqualError(t, a.Serve(l), "no database")
+}
+
+// Test that requests served outside of Serve, e.g. by a test server, don't
+// race with it.
+func TestServeConcurrentRequests(t *testing.T) {
+	a := New()
+	a.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+
+	stop := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			r, _ := http.NewRequest("GET", "/", nil)
+			a.ServeHTTP(httptest.NewRecorder(), r)
+		}
+	}()
+
+	_, done := startApp(t, a)
+	a.Shutdown()
+	assert.NoError(t, <-done)
+	close(stop)
+	<-finished
+}
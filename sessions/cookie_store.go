@@ -0,0 +1,137 @@
+package sessions
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+)
+
+// maxCookieLength is the longest cookie value that a CookieStore will
+// create; browsers limit cookies to around 4KB.
+const maxCookieLength = 4000
+
+// ErrCookieTooLong is returned by CookieStore.Save if a session is too large
+// to fit in a cookie.
+var ErrCookieTooLong = errors.New("sessions: session is too large for a cookie")
+
+// CookieStore is a Store that keeps the whole session in the cookie, so
+// nothing needs to be stored on the server.  The cookie is either signed,
+// which stops the client from changing it but not from reading it, or
+// encrypted, which does both.
+//
+// Since nothing is stored on the server, a session can't be revoked before
+// it expires: Session.Destroy only expires the cookie in the browser.
+type CookieStore struct {
+	signKey []byte
+	aead    cipher.AEAD
+}
+
+// NewSignedCookieStore creates a CookieStore that signs cookies with
+// HMAC-SHA256 using the given key, which should be at least 32 random bytes.
+func NewSignedCookieStore(key []byte) *CookieStore {
+	return &CookieStore{signKey: key}
+}
+
+// NewEncryptedCookieStore creates a CookieStore that encrypts cookies with
+// AES-GCM using the given key, which must be 16, 24 or 32 bytes long.
+func NewEncryptedCookieStore(key []byte) (*CookieStore, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &CookieStore{aead: aead}, nil
+}
+
+// Load implements Store.  Cookies that have been tampered with are treated as
+// if there were no session.
+func (c *CookieStore) Load(cookie string) ([]byte, error) {
+	var payload []byte
+	if c.aead != nil {
+		payload = c.decrypt(cookie)
+	} else {
+		payload = c.verify(cookie)
+	}
+
+	// The payload is the expiry time followed by the data.
+	if len(payload) < 8 {
+		return nil, nil
+	}
+	expires := time.Unix(int64(binary.BigEndian.Uint64(payload[:8])), 0)
+	if !time.Now().Before(expires) {
+		return nil, nil
+	}
+	return payload[8:], nil
+}
+
+// Save implements Store.
+func (c *CookieStore) Save(cookie string, data []byte, expires time.Time) (string, error) {
+	payload := make([]byte, 8+len(data))
+	binary.BigEndian.PutUint64(payload[:8], uint64(expires.Unix()))
+	copy(payload[8:], data)
+
+	var value string
+	if c.aead != nil {
+		nonce := make([]byte, c.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return "", err
+		}
+		value = base64.RawURLEncoding.EncodeToString(c.aead.Seal(nonce, nonce, payload, nil))
+	} else {
+		value = base64.RawURLEncoding.EncodeToString(payload) + "." +
+			base64.RawURLEncoding.EncodeToString(c.sign(payload))
+	}
+
+	if len(value) > maxCookieLength {
+		return "", ErrCookieTooLong
+	}
+	return value, nil
+}
+
+// Delete implements Store.  It does nothing, since the session only exists in
+// the cookie.
+func (c *CookieStore) Delete(cookie string) error {
+	return nil
+}
+
+func (c *CookieStore) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, c.signKey)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+func (c *CookieStore) verify(cookie string) []byte {
+	i := strings.Index(cookie, ".")
+	if i < 0 {
+		return nil
+	}
+	payload, err1 := base64.RawURLEncoding.DecodeString(cookie[:i])
+	sig, err2 := base64.RawURLEncoding.DecodeString(cookie[i+1:])
+	if err1 != nil || err2 != nil || !hmac.Equal(sig, c.sign(payload)) {
+		return nil
+	}
+	return payload
+}
+
+func (c *CookieStore) decrypt(cookie string) []byte {
+	sealed, err := base64.RawURLEncoding.DecodeString(cookie)
+	if err != nil || len(sealed) < c.aead.NonceSize() {
+		return nil
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	payload, err := c.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil
+	}
+	return payload
+}
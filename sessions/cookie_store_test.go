@@ -0,0 +1,57 @@
+package sessions
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCookieStore(t *testing.T) {
+	encrypted, err := NewEncryptedCookieStore([]byte("0123456789abcdef"))
+	assert.NoError(t, err)
+	signed := NewSignedCookieStore([]byte("secret"))
+
+	for _, store := range []*CookieStore{signed, encrypted} {
+		cookie, err := store.Save("", []byte("hello"), time.Now().Add(time.Hour))
+		assert.NoError(t, err)
+
+		data, err := store.Load(cookie)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("hello"), data)
+
+		// Tampered, foreign and expired cookies are ignored.
+		tampered := []byte(cookie)
+		tampered[2] ^= 1
+		data, _ = store.Load(string(tampered))
+		assert.Nil(t, data)
+
+		data, _ = store.Load("garbage")
+		assert.Nil(t, data)
+
+		expired, _ := store.Save("", []byte("hello"), time.Now().Add(-time.Second))
+		data, _ = store.Load(expired)
+		assert.Nil(t, data)
+	}
+
+	// Signed cookies can be read by the client, but encrypted ones can't.
+	c1, _ := signed.Save("", []byte("hello"), time.Now().Add(time.Hour))
+	c2, _ := encrypted.Save("", []byte("hello"), time.Now().Add(time.Hour))
+	assert.True(t, strings.HasPrefix(c1, "AAAA"))
+	assert.NotEqual(t, c1, c2)
+
+	other := NewSignedCookieStore([]byte("other"))
+	data, _ := other.Load(c1)
+	assert.Nil(t, data)
+}
+
+func TestCookieStoreLimits(t *testing.T) {
+	_, err := NewEncryptedCookieStore([]byte("short"))
+	assert.Error(t, err)
+
+	store := NewSignedCookieStore([]byte("secret"))
+	_, err = store.Save("", bytes.Repeat([]byte("x"), 4000), time.Now().Add(time.Hour))
+	assert.Equal(t, ErrCookieTooLong, err)
+}
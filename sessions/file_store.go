@@ -0,0 +1,133 @@
+package sessions
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileStore is a Store that keeps each session in a file in a directory,
+// referred to by a random ID.  Sessions survive restarts, and can be shared
+// between processes on the same machine.
+//
+// Expired sessions are ignored, but their files are only removed by Cleanup,
+// which should be called periodically.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore creates a FileStore that keeps sessions in the given
+// directory, creating it if necessary.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// path returns the path of the file for the session with the given ID, or
+// the empty string if the ID isn't one that we could have created.  This
+// stops a client from using its cookie to name other files.
+func (f *FileStore) path(id string) string {
+	b, err := base64.RawURLEncoding.DecodeString(id)
+	if err != nil || len(b) != idLength {
+		return ""
+	}
+	return filepath.Join(f.dir, "session_"+id)
+}
+
+// Load implements Store.
+func (f *FileStore) Load(cookie string) ([]byte, error) {
+	path := f.path(cookie)
+	if path == "" {
+		return nil, nil
+	}
+
+	// The file contains the expiry time followed by the data.
+	contents, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if len(contents) < 8 {
+		return nil, nil
+	}
+	expires := time.Unix(int64(binary.BigEndian.Uint64(contents[:8])), 0)
+	if !time.Now().Before(expires) {
+		return nil, nil
+	}
+	return contents[8:], nil
+}
+
+// Save implements Store.
+func (f *FileStore) Save(cookie string, data []byte, expires time.Time) (string, error) {
+	path := f.path(cookie)
+	if path == "" {
+		id, err := newID()
+		if err != nil {
+			return "", err
+		}
+		cookie = id
+		path = f.path(id)
+	}
+
+	contents := make([]byte, 8+len(data))
+	binary.BigEndian.PutUint64(contents[:8], uint64(expires.Unix()))
+	copy(contents[8:], data)
+
+	// Write to a temporary file and rename it into place, so that a
+	// concurrent Load never sees a partial file.
+	tmp, err := os.CreateTemp(f.dir, "tmp_")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return cookie, nil
+}
+
+// Delete implements Store.
+func (f *FileStore) Delete(cookie string) error {
+	path := f.path(cookie)
+	if path == "" {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Cleanup removes the files of expired sessions.
+func (f *FileStore) Cleanup() error {
+	paths, err := filepath.Glob(filepath.Join(f.dir, "session_*"))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, path := range paths {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if len(contents) < 8 || !now.Before(time.Unix(int64(binary.BigEndian.Uint64(contents[:8])), 0)) {
+			os.Remove(path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package sessions
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/andrew-d/wolf/wolftest"
+)
+
+func TestFileStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "sessions")
+	store, err := NewFileStore(dir)
+	assert.NoError(t, err)
+
+	id, err := store.Save("", []byte("hello"), time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	data, err := store.Load(id)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello"), data)
+
+	// Saving again keeps the ID.
+	id2, err := store.Save(id, []byte("world"), time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, id, id2)
+	data, _ = store.Load(id)
+	assert.Equal(t, []byte("world"), data)
+
+	assert.NoError(t, store.Delete(id))
+	data, err = store.Load(id)
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+	assert.NoError(t, store.Delete(id))
+}
+
+// Test that a cookie can't be used to read other files.
+func TestFileStorePaths(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(filepath.Join(dir, "sessions"))
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0600))
+
+	data, err := store.Load("../secret")
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+
+	// A cookie that isn't a valid ID gets a new one.
+	id, err := store.Save("../secret", []byte("x"), time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.NotEqual(t, "../secret", id)
+	contents, _ := os.ReadFile(filepath.Join(dir, "secret"))
+	assert.Equal(t, "secret", string(contents))
+}
+
+func TestFileStoreCleanup(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	assert.NoError(t, err)
+
+	live, _ := store.Save("", []byte("live"), time.Now().Add(time.Hour))
+	store.Save("", []byte("dead"), time.Now().Add(-time.Hour))
+
+	assert.NoError(t, store.Cleanup())
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	assert.Equal(t, []string{filepath.Join(dir, "session_"+live)}, files)
+}
+
+func TestFileStoreMiddleware(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	assert.NoError(t, err)
+
+	srv := wolftest.NewServer(sessionApp(Options{Store: store}))
+	srv.Do(wolftest.NewRequest("POST", "/login/carol")).AssertStatus(t, 200)
+	srv.Do(wolftest.NewRequest("GET", "/")).AssertBody(t, "user=carol new=false")
+
+	// A new App with the same store sees the session.
+	srv.Client.Transport = wolftest.NewServer(sessionApp(Options{Store: store})).Client.Transport
+	srv.Do(wolftest.NewRequest("GET", "/")).AssertBody(t, "user=carol new=false")
+}
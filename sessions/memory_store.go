@@ -0,0 +1,90 @@
+package sessions
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"sync"
+	"time"
+)
+
+// idLength is the length of session IDs, in bytes before encoding.
+const idLength = 32
+
+// newID returns a random session ID, encoded as URL-safe base64.
+func newID() (string, error) {
+	var buf [idLength]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf[:]), nil
+}
+
+// MemoryStore is a Store that keeps sessions in memory, referred to by a
+// random ID.  Sessions are lost when the process exits, and aren't shared
+// between processes.  Expired sessions are removed periodically as the store
+// is used.
+type MemoryStore struct {
+	mu        sync.Mutex
+	sessions  map[string]memorySession
+	lastSweep time.Time
+}
+
+type memorySession struct {
+	data    []byte
+	expires time.Time
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions:  make(map[string]memorySession),
+		lastSweep: time.Now(),
+	}
+}
+
+// Load implements Store.
+func (m *MemoryStore) Load(cookie string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[cookie]
+	if !ok || !time.Now().Before(s.expires) {
+		return nil, nil
+	}
+	return s.data, nil
+}
+
+// Save implements Store.
+func (m *MemoryStore) Save(cookie string, data []byte, expires time.Time) (string, error) {
+	if cookie == "" {
+		id, err := newID()
+		if err != nil {
+			return "", err
+		}
+		cookie = id
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.lastSweep) > time.Minute {
+		for id, s := range m.sessions {
+			if !now.Before(s.expires) {
+				delete(m.sessions, id)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	m.sessions[cookie] = memorySession{data: data, expires: expires}
+	return cookie, nil
+}
+
+// Delete implements Store.
+func (m *MemoryStore) Delete(cookie string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, cookie)
+	return nil
+}
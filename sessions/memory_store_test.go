@@ -0,0 +1,39 @@
+package sessions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+
+	id, err := store.Save("", []byte("hello"), time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, id, 43)
+
+	data, err := store.Load(id)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello"), data)
+
+	data, _ = store.Load("unknown")
+	assert.Nil(t, data)
+
+	assert.NoError(t, store.Delete(id))
+	data, _ = store.Load(id)
+	assert.Nil(t, data)
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	store := NewMemoryStore()
+	expired, _ := store.Save("", []byte("x"), time.Now().Add(-time.Second))
+	data, _ := store.Load(expired)
+	assert.Nil(t, data)
+
+	// Expired sessions are swept away.
+	store.lastSweep = time.Time{}
+	store.Save("", []byte("y"), time.Now().Add(time.Hour))
+	assert.Len(t, store.sessions, 1)
+}
@@ -0,0 +1,343 @@
+// Package sessions provides per-request sessions for wolf Apps.
+//
+// The middleware loads the session for each request into the context, and
+// saves it once the handler has finished if it was changed:
+//
+//	store, err := sessions.NewEncryptedCookieStore(key)
+//	...
+//	a.Use(sessions.Middleware(sessions.Options{Store: store}))
+//
+//	a.Post("/login", func(c context.Context, w http.ResponseWriter, r *http.Request) {
+//		s := sessions.Get(c)
+//		s.RegenerateID()
+//		s.Set("user", user.ID)
+//	})
+//
+// Sessions can be kept entirely in a cookie (see CookieStore), or on the
+// server with only an ID in the cookie (see MemoryStore and FileStore).
+// Values are encoded with encoding/gob, so types other than the basic ones
+// must be registered with gob.Register.
+package sessions
+
+import (
+	"bytes"
+	"encoding/gob"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf/internal/writerproxy"
+)
+
+// Internal private type for context keys.
+type private int
+
+var sessionKey private
+
+// Store persists encoded sessions, which are referred to by the value of the
+// session cookie.  Implementations must be safe for concurrent use.
+type Store interface {
+	// Load returns the encoded session referred to by the given cookie
+	// value.  It returns nil data, and no error, if there is no such session
+	// or it has expired.
+	Load(cookie string) ([]byte, error)
+
+	// Save stores an encoded session that expires at the given time, and
+	// returns the cookie value that refers to it.  cookie is the session's
+	// current cookie value, or the empty string if the session is new or is
+	// being given a new ID.
+	Save(cookie string, data []byte, expires time.Time) (string, error)
+
+	// Delete removes the session referred to by the given cookie value.
+	Delete(cookie string) error
+}
+
+// DefaultMaxAge is how long sessions last if Options.MaxAge is not set.
+const DefaultMaxAge = 24 * time.Hour
+
+// Options controls the behaviour of the session middleware.
+type Options struct {
+	// Store holds the sessions.  It is required.
+	Store Store
+
+	// CookieName is the name of the session cookie.  Defaults to
+	// "session".
+	CookieName string
+
+	// Path and Domain are the scope of the session cookie.  Path defaults
+	// to "/".
+	Path   string
+	Domain string
+
+	// MaxAge is how long a session lasts.  Defaults to DefaultMaxAge.
+	MaxAge time.Duration
+
+	// Rolling makes MaxAge count from the most recent request in the
+	// session, rather than from when it was created, so that sessions only
+	// expire once they have been idle for MaxAge.  The session is saved on
+	// every request to extend it.
+	Rolling bool
+
+	// Secure restricts the cookie to HTTPS connections.
+	Secure bool
+
+	// SameSite is the SameSite attribute of the cookie.  Defaults to
+	// http.SameSiteLaxMode.
+	SameSite http.SameSite
+
+	// OnError, if set, is called when a session can't be loaded or saved.
+	// By default the error is logged.  A session that can't be loaded is
+	// replaced with a new one.
+	OnError func(r *http.Request, err error)
+}
+
+// Session holds the values stored for a single client.  It is safe for
+// concurrent use.
+type Session struct {
+	mu      sync.Mutex
+	values  map[string]interface{}
+	cookie  string
+	expires time.Time
+
+	changed    bool
+	regenerate bool
+	destroyed  bool
+}
+
+// record is how a session is encoded for a Store.
+type record struct {
+	Values  map[string]interface{}
+	Expires time.Time
+}
+
+// Get returns the value stored under the given key, or nil if there isn't
+// one.
+func (s *Session) Get(key string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.values[key]
+}
+
+// GetString returns the value stored under the given key if it is a string,
+// or the empty string otherwise.
+func (s *Session) GetString(key string) string {
+	v, _ := s.Get(key).(string)
+	return v
+}
+
+// Set stores a value under the given key.
+func (s *Session) Set(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+	s.changed = true
+	s.destroyed = false
+}
+
+// Delete removes the value stored under the given key.
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.values[key]; ok {
+		delete(s.values, key)
+		s.changed = true
+	}
+}
+
+// Destroy removes all values from the session, deletes it from the store and
+// expires the cookie.  Use it when logging a user out.
+func (s *Session) Destroy() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values = make(map[string]interface{})
+	s.destroyed = true
+	s.regenerate = true
+}
+
+// RegenerateID gives the session a new ID when it is saved, keeping its
+// values.  Call it whenever the user's privileges change, such as on login,
+// to prevent session fixation attacks.
+func (s *Session) RegenerateID() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.regenerate = true
+}
+
+// IsNew reports whether the session was created for this request, rather than
+// loaded from the store.
+func (s *Session) IsNew() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cookie == ""
+}
+
+// Get returns the session from the given context.  It returns nil if the
+// session middleware was not used.
+func Get(ctx context.Context) *Session {
+	val := ctx.Value(&sessionKey)
+	if val == nil {
+		return nil
+	}
+	return val.(*Session)
+}
+
+// Middleware creates a middleware that loads the session for each request,
+// which handlers retrieve with Get.
+//
+// The session is saved, if it changed, just before the response headers are
+// written, or when the handler returns if it didn't write anything.  Changes
+// made after the handler has started writing its response are lost.
+func Middleware(opts Options) func(*context.Context, http.Handler) http.Handler {
+	if opts.Store == nil {
+		panic("sessions: Middleware requires a Store")
+	}
+	if opts.CookieName == "" {
+		opts.CookieName = "session"
+	}
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+	if opts.MaxAge == 0 {
+		opts.MaxAge = DefaultMaxAge
+	}
+	if opts.SameSite == 0 {
+		opts.SameSite = http.SameSiteLaxMode
+	}
+	if opts.OnError == nil {
+		opts.OnError = func(r *http.Request, err error) {
+			log.Printf("sessions: %v", err)
+		}
+	}
+
+	middlewareFunc := func(ctx *context.Context, h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			s := load(&opts, r)
+			*ctx = context.WithValue(*ctx, &sessionKey, s)
+
+			// The session is saved just before the response headers are
+			// written, since the cookie can't be set after that, or once the
+			// handler returns if it wrote nothing.
+			committed := false
+			commit := func() {
+				if committed {
+					return
+				}
+				committed = true
+				if err := s.save(&opts, w); err != nil {
+					opts.OnError(r, err)
+				}
+			}
+
+			h.ServeHTTP(writerproxy.Wrap(w, commit), r)
+			commit()
+		}
+
+		return http.HandlerFunc(fn)
+	}
+
+	return middlewareFunc
+}
+
+// load loads the request's session, or creates a new one.
+func load(opts *Options, r *http.Request) *Session {
+	s := &Session{
+		values:  make(map[string]interface{}),
+		expires: time.Now().Add(opts.MaxAge),
+	}
+
+	c, err := r.Cookie(opts.CookieName)
+	if err != nil || c.Value == "" {
+		return s
+	}
+
+	data, err := opts.Store.Load(c.Value)
+	if err != nil {
+		opts.OnError(r, err)
+		return s
+	}
+	if data == nil {
+		return s
+	}
+
+	var rec record
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&rec); err != nil {
+		opts.OnError(r, err)
+		return s
+	}
+	if !time.Now().Before(rec.Expires) {
+		return s
+	}
+	if rec.Values != nil {
+		s.values = rec.Values
+	}
+	s.cookie = c.Value
+	if !opts.Rolling {
+		s.expires = rec.Expires
+	}
+	return s
+}
+
+// save saves the session if needed, and sets or expires the cookie.
+func (s *Session) save(opts *Options, w http.ResponseWriter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.destroyed {
+		if s.cookie == "" {
+			return nil
+		}
+		err := opts.Store.Delete(s.cookie)
+		s.cookie = ""
+		http.SetCookie(w, opts.cookie("", time.Unix(0, 0), -1))
+		return err
+	}
+
+	// New sessions are only saved once something is stored in them.
+	if !s.changed && (s.cookie == "" || !s.regenerate && !opts.Rolling) {
+		return nil
+	}
+
+	if s.regenerate && s.cookie != "" {
+		if err := opts.Store.Delete(s.cookie); err != nil {
+			return err
+		}
+		s.cookie = ""
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(record{s.values, s.expires}); err != nil {
+		return err
+	}
+
+	cookie, err := opts.Store.Save(s.cookie, buf.Bytes(), s.expires)
+	if err != nil {
+		return err
+	}
+	s.cookie = cookie
+	s.changed = false
+	s.regenerate = false
+
+	maxAge := int(time.Until(s.expires) / time.Second)
+	if maxAge <= 0 {
+		maxAge = -1
+	}
+	http.SetCookie(w, opts.cookie(cookie, s.expires, maxAge))
+	return nil
+}
+
+func (opts *Options) cookie(value string, expires time.Time, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     opts.CookieName,
+		Value:    value,
+		Path:     opts.Path,
+		Domain:   opts.Domain,
+		Expires:  expires,
+		MaxAge:   maxAge,
+		Secure:   opts.Secure,
+		HttpOnly: true,
+		SameSite: opts.SameSite,
+	}
+}
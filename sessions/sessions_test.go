@@ -0,0 +1,211 @@
+package sessions
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf"
+	"github.com/andrew-d/wolf/wolftest"
+)
+
+// sessionApp has routes to log in and out, and to show the current user.
+func sessionApp(opts Options) *wolf.App {
+	a := wolf.New()
+	a.Use(Middleware(opts))
+
+	a.Post("/login/:user", func(c context.Context, w http.ResponseWriter, r *http.Request) {
+		s := Get(c)
+		s.RegenerateID()
+		user, _ := wolf.ParamFrom(c, "user")
+		s.Set("user", user)
+	})
+	a.Post("/logout", func(c context.Context, w http.ResponseWriter, r *http.Request) {
+		Get(c).Destroy()
+	})
+	a.Get("/", func(c context.Context, w http.ResponseWriter, r *http.Request) {
+		s := Get(c)
+		fmt.Fprintf(w, "user=%s new=%v", s.GetString("user"), s.IsNew())
+	})
+	return a
+}
+
+func sessionCookie(resp *wolftest.Response) *http.Cookie {
+	for _, c := range resp.Cookies() {
+		if c.Name == "session" {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestSessionLifecycle(t *testing.T) {
+	stores := map[string]Store{
+		"signed cookie": NewSignedCookieStore([]byte("0123456789abcdef0123456789abcdef")),
+		"memory":        NewMemoryStore(),
+	}
+	for name, store := range stores {
+		srv := wolftest.NewServer(sessionApp(Options{Store: store}))
+
+		// A new, empty session isn't saved.
+		resp := srv.Do(wolftest.NewRequest("GET", "/"))
+		resp.AssertBody(t, "user= new=true")
+		assert.Nil(t, sessionCookie(resp), name)
+
+		resp = srv.Do(wolftest.NewRequest("POST", "/login/alice"))
+		c := sessionCookie(resp)
+		if assert.NotNil(t, c, name) {
+			assert.True(t, c.HttpOnly, name)
+			assert.Equal(t, http.SameSiteLaxMode, c.SameSite, name)
+			assert.Equal(t, "/", c.Path, name)
+		}
+
+		srv.Do(wolftest.NewRequest("GET", "/")).AssertBody(t, "user=alice new=false")
+
+		// An unchanged session isn't saved again.
+		resp = srv.Do(wolftest.NewRequest("GET", "/"))
+		assert.Nil(t, sessionCookie(resp), name)
+
+		resp = srv.Do(wolftest.NewRequest("POST", "/logout"))
+		c = sessionCookie(resp)
+		if assert.NotNil(t, c, name) {
+			assert.Equal(t, -1, c.MaxAge, name)
+		}
+		srv.Do(wolftest.NewRequest("GET", "/")).AssertBody(t, "user= new=true")
+	}
+}
+
+// Test that logging in gives the session a new ID, and the old one stops
+// working.
+func TestSessionRegenerateID(t *testing.T) {
+	store := NewMemoryStore()
+	srv := wolftest.NewServer(sessionApp(Options{Store: store}))
+
+	first := sessionCookie(srv.Do(wolftest.NewRequest("POST", "/login/alice")))
+	second := sessionCookie(srv.Do(wolftest.NewRequest("POST", "/login/bob")))
+	assert.NotEqual(t, first.Value, second.Value)
+
+	a := sessionApp(Options{Store: store})
+	wolftest.NewRequest("GET", "/").WithCookie(first).Serve(a).AssertBody(t, "user= new=true")
+	wolftest.NewRequest("GET", "/").WithCookie(second).Serve(a).AssertBody(t, "user=bob new=false")
+}
+
+func TestSessionExpiry(t *testing.T) {
+	store := NewMemoryStore()
+	a := sessionApp(Options{Store: store, MaxAge: time.Hour})
+
+	resp := wolftest.NewRequest("POST", "/login/alice").Serve(a)
+	c := sessionCookie(resp)
+	assert.InDelta(t, 3600, c.MaxAge, 1)
+
+	// Without rolling expiry, reading the session doesn't extend it.
+	resp = wolftest.NewRequest("GET", "/").WithCookie(c).Serve(a)
+	assert.Nil(t, sessionCookie(resp))
+
+	// With it, every request does.
+	a = sessionApp(Options{Store: store, MaxAge: time.Hour, Rolling: true})
+	resp = wolftest.NewRequest("GET", "/").WithCookie(c).Serve(a)
+	resp.AssertBody(t, "user=alice new=false")
+	rolled := sessionCookie(resp)
+	if assert.NotNil(t, rolled) {
+		assert.Equal(t, c.Value, rolled.Value)
+		assert.InDelta(t, 3600, rolled.MaxAge, 1)
+	}
+
+	// An expired session is replaced with a new one.
+	data, _ := store.Load(c.Value)
+	store.Save(c.Value, data, time.Now().Add(-time.Second))
+	wolftest.NewRequest("GET", "/").WithCookie(c).Serve(a).AssertBody(t, "user= new=true")
+}
+
+// Test that the cookie is set even if the handler writes a response.
+func TestSessionSavedBeforeHeaders(t *testing.T) {
+	a := wolf.New()
+	a.Use(Middleware(Options{Store: NewMemoryStore(), CookieName: "sid"}))
+	a.Get("/", func(c context.Context, w http.ResponseWriter, r *http.Request) {
+		Get(c).Set("n", 1)
+		w.WriteHeader(201)
+		w.Write([]byte("created"))
+	})
+
+	resp := wolftest.NewRequest("GET", "/").Serve(a)
+	resp.AssertStatus(t, 201)
+	if assert.Len(t, resp.Cookies(), 1) {
+		assert.Equal(t, "sid", resp.Cookies()[0].Name)
+	}
+}
+
+// Test that the writer passed to handlers keeps the optional interfaces of
+// the server's, and that the cookie is set when the body is written with
+// ReadFrom.
+func TestSessionWriterInterfaces(t *testing.T) {
+	a := wolf.New()
+	a.Use(Middleware(Options{Store: NewMemoryStore()}))
+	a.Get("/", func(c context.Context, w http.ResponseWriter, r *http.Request) {
+		assert.Implements(t, (*http.Flusher)(nil), w)
+		assert.Implements(t, (*http.Hijacker)(nil), w)
+		assert.Implements(t, (*http.CloseNotifier)(nil), w)
+		assert.Implements(t, (*io.ReaderFrom)(nil), w)
+
+		Get(c).Set("n", 1)
+		w.(io.ReaderFrom).ReadFrom(strings.NewReader("hello"))
+	})
+
+	srv := httptest.NewServer(a)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Len(t, resp.Cookies(), 1)
+	}
+}
+
+type failingStore struct{ *MemoryStore }
+
+func (failingStore) Save(string, []byte, time.Time) (string, error) {
+	return "", errors.New("disk full")
+}
+
+func TestSessionOnError(t *testing.T) {
+	var errs []error
+	a := sessionApp(Options{
+		Store: failingStore{NewMemoryStore()},
+		OnError: func(r *http.Request, err error) {
+			errs = append(errs, err)
+		},
+	})
+
+	resp := wolftest.NewRequest("POST", "/login/alice").Serve(a)
+	resp.AssertStatus(t, 200)
+	assert.Nil(t, sessionCookie(resp))
+	assert.Equal(t, []error{errors.New("disk full")}, errs)
+
+	// A cookie that can't be decoded is replaced with a new session.
+	errs = nil
+	a = sessionApp(Options{
+		Store: NewSignedCookieStore([]byte("key")),
+		OnError: func(r *http.Request, err error) {
+			errs = append(errs, err)
+		},
+	})
+	store := NewSignedCookieStore([]byte("key"))
+	bad, _ := store.Save("", []byte("not gob"), time.Now().Add(time.Hour))
+	wolftest.NewRequest("GET", "/").
+		WithCookie(&http.Cookie{Name: "session", Value: bad}).
+		Serve(a).
+		AssertBody(t, "user= new=true")
+	assert.Len(t, errs, 1)
+}
+
+func TestGetMissing(t *testing.T) {
+	assert.Nil(t, Get(context.Background()))
+}
@@ -0,0 +1,307 @@
+package wolf
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// StaticOptions controls how files are served by App.StaticWithOptions.  The
+// zero value is what App.Static uses.
+type StaticOptions struct {
+	// ListDirectories enables HTML listings for directories that do not
+	// contain an index.html file.  Listings are disabled by default.
+	ListDirectories bool
+
+	// SPAFallback causes requests for files that do not exist to be answered
+	// with the index.html file at the root of the file system, so that a
+	// client-side router can handle them.
+	SPAFallback bool
+
+	// MaxAge, if non-zero, is sent as the max-age of a public Cache-Control
+	// header for every file other than the SPA fallback.
+	MaxAge time.Duration
+}
+
+// Static serves the files in fsys under the given path prefix.  Use
+// os.DirFS to serve a directory on disk, or pass an embed.FS directly.
+//
+// Files are served with ETag and Last-Modified headers, and a sibling file
+// with a ".gz" suffix is served in place of the original when the client
+// accepts gzip encoding.  Directory listings are disabled.
+//
+// Static registers a catch-all route, so no other routes may be registered
+// below the prefix.  A prefix of "/" is special-cased: the files are served
+// from the router's NotFound handler, so that they can coexist with other
+// routes.
+func (a *App) Static(prefix string, fsys fs.FS) {
+	a.StaticWithOptions(prefix, fsys, StaticOptions{})
+}
+
+// StaticWithOptions is like Static, but allows configuring how the files are
+// served.
+func (a *App) StaticWithOptions(prefix string, fsys fs.FS, opts StaticOptions) {
+	prefix = strings.TrimRight(prefix, "/")
+	a.mountStatic(&staticHandler{
+		fs:     fsys,
+		prefix: prefix,
+		opts:   opts,
+	})
+}
+
+// mountStatic registers the routes for a staticHandler.
+func (a *App) mountStatic(h *staticHandler) {
+	prefix := h.prefix
+	if prefix == "" {
+		handle := a.wrapHandler("/*filepath", h)
+		a.router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handle(w, r, nil)
+		})
+		return
+	}
+
+	a.Get(prefix+"/*filepath", h)
+	a.Head(prefix+"/*filepath", h)
+}
+
+// staticHandler serves the files from a fs.FS.
+type staticHandler struct {
+	fs     fs.FS
+	prefix string
+	opts   StaticOptions
+
+	// If set, fingerprinted names from this manifest are also served.
+	assets *Assets
+
+	// Cache of content hashes for files without a modification time (e.g.
+	// files from an embed.FS).
+	etags sync.Map
+}
+
+func (s *staticHandler) ServeHTTPCtx(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Turn the request path into a name that is valid for a fs.FS.
+	upath := strings.TrimPrefix(r.URL.Path, s.prefix)
+	name := strings.TrimPrefix(path.Clean("/"+upath), "/")
+	if name == "" {
+		name = "."
+	}
+
+	// Fingerprinted names never change content, so they can be cached
+	// forever.
+	immutable := false
+	if s.assets != nil {
+		if orig, ok := s.assets.originals[name]; ok {
+			name = orig
+			immutable = true
+		}
+	}
+
+	f, info, err := s.open(name)
+	if err != nil {
+		s.notFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	if info.IsDir() {
+		// Relative links in an index or listing only work with a trailing
+		// slash, so redirect like http.FileServer does.
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			redirectTo(w, r, path.Base(r.URL.Path)+"/")
+			return
+		}
+
+		index := path.Join(name, "index.html")
+		if ff, finfo, err := s.open(index); err == nil {
+			defer ff.Close()
+			s.serveFile(w, r, index, ff, finfo)
+			return
+		}
+
+		if s.opts.ListDirectories {
+			s.listDirectory(w, r, name)
+			return
+		}
+
+		s.notFound(w, r)
+		return
+	}
+
+	if immutable {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		s.serveContent(w, r, name, f, info)
+		return
+	}
+
+	s.serveFile(w, r, name, f, info)
+}
+
+func (s *staticHandler) open(name string) (fs.File, fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, nil, fs.ErrInvalid
+	}
+
+	f, err := s.fs.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	return f, info, nil
+}
+
+// serveFile writes a single file to the client, substituting a precompressed
+// version of it if one exists and the client accepts it.
+func (s *staticHandler) serveFile(w http.ResponseWriter, r *http.Request, name string, f fs.File, info fs.FileInfo) {
+	if s.opts.MaxAge > 0 {
+		w.Header().Set("Cache-Control", "public, max-age="+
+			strconv.Itoa(int(s.opts.MaxAge/time.Second)))
+	}
+	s.serveContent(w, r, name, f, info)
+}
+
+func (s *staticHandler) serveContent(w http.ResponseWriter, r *http.Request, name string, f fs.File, info fs.FileInfo) {
+	h := w.Header()
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		h.Set("Content-Type", ctype)
+	}
+
+	// Look for a precompressed sibling.  The Content-Type is set above from
+	// the original name, so ServeContent won't try to sniff the gzip data.
+	h.Add("Vary", "Accept-Encoding")
+	if acceptsGzip(r) && !strings.HasSuffix(name, ".gz") {
+		if gf, ginfo, err := s.open(name + ".gz"); err == nil {
+			defer gf.Close()
+			if !ginfo.IsDir() {
+				if rs, ok := gf.(io.ReadSeeker); ok {
+					h.Set("Content-Encoding", "gzip")
+					h.Set("ETag", s.etag(name+".gz", gf, ginfo))
+					http.ServeContent(w, r, name, ginfo.ModTime(), rs)
+					return
+				}
+			}
+		}
+	}
+
+	rs, ok := f.(io.ReadSeeker)
+	if !ok {
+		http.Error(w, "file does not support seeking", http.StatusInternalServerError)
+		return
+	}
+
+	h.Set("ETag", s.etag(name, f, info))
+	http.ServeContent(w, r, name, info.ModTime(), rs)
+}
+
+// etag returns a strong ETag for the given file.  Files with a modification
+// time use it and the size; files without one (as in an embed.FS) are hashed
+// once and cached.
+func (s *staticHandler) etag(name string, f fs.File, info fs.FileInfo) string {
+	if !info.ModTime().IsZero() {
+		return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+	}
+
+	if tag, ok := s.etags.Load(name); ok {
+		return tag.(string)
+	}
+
+	hash := fnv.New64a()
+	if _, err := io.Copy(hash, f); err != nil {
+		return ""
+	}
+	if rs, ok := f.(io.Seeker); ok {
+		rs.Seek(0, io.SeekStart)
+	}
+
+	tag := fmt.Sprintf(`"%x"`, hash.Sum64())
+	s.etags.Store(name, tag)
+	return tag
+}
+
+// notFound either sends a 404, or serves the SPA fallback page.
+func (s *staticHandler) notFound(w http.ResponseWriter, r *http.Request) {
+	if !s.opts.SPAFallback {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, info, err := s.open("index.html")
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	// The fallback page answers for many URLs, so it must not be cached as
+	// if it were the resource at this one.
+	w.Header().Set("Cache-Control", "no-cache")
+	s.serveContent(w, r, "index.html", f, info)
+}
+
+func (s *staticHandler) listDirectory(w http.ResponseWriter, r *http.Request, name string) {
+	entries, err := fs.ReadDir(s.fs, name)
+	if err != nil {
+		http.Error(w, "error reading directory", http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<pre>\n")
+	for _, entry := range entries {
+		ename := entry.Name()
+		if entry.IsDir() {
+			ename += "/"
+		}
+
+		u := url.URL{Path: ename}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", u.String(), html.EscapeString(ename))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+}
+
+// acceptsGzip returns whether the request's Accept-Encoding header allows a
+// gzip-encoded response.
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		enc = strings.TrimSpace(enc)
+		if enc == "gzip" || strings.HasPrefix(enc, "gzip;") && !strings.HasSuffix(enc, "q=0") {
+			return true
+		}
+	}
+	return false
+}
+
+// redirectTo sends a relative redirect, preserving the query string.
+func redirectTo(w http.ResponseWriter, r *http.Request, target string) {
+	if q := r.URL.RawQuery; q != "" {
+		target += "?" + q
+	}
+	w.Header().Set("Location", target)
+	w.WriteHeader(http.StatusMovedPermanently)
+}
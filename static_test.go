@@ -0,0 +1,103 @@
+package wolf_test
+
+import (
+	"net/http"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf"
+	"github.com/andrew-d/wolf/wolftest"
+)
+
+var testFS = fstest.MapFS{
+	"index.html":       {Data: []byte("<h1>index</h1>"), ModTime: time.Unix(1400000000, 0)},
+	"app.js":           {Data: []byte("console.log(1)")},
+	"app.js.gz":        {Data: []byte("gzipped")},
+	"css/site.css":     {Data: []byte("body{}"), ModTime: time.Unix(1400000000, 0)},
+	"docs/index.html":  {Data: []byte("docs")},
+	"empty/readme.txt": {Data: []byte("readme")},
+}
+
+func TestStatic(t *testing.T) {
+	a := wolf.New()
+	a.Static("/assets", testFS)
+
+	resp := wolftest.NewRequest("GET", "/assets/css/site.css").Serve(a)
+	resp.AssertStatus(t, 200)
+	resp.AssertBody(t, "body{}")
+	assert.Equal(t, "text/css; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.NotEmpty(t, resp.Header.Get("ETag"))
+	assert.NotEmpty(t, resp.Header.Get("Last-Modified"))
+
+	// Conditional requests should be honoured
+	resp = wolftest.NewRequest("GET", "/assets/css/site.css").WithHeader("If-None-Match", resp.Header.Get("ETag")).Serve(a)
+	resp.AssertStatus(t, 304)
+
+	// Files without a modification time still get an ETag
+	resp = wolftest.NewRequest("GET", "/assets/app.js").Serve(a)
+	resp.AssertBody(t, "console.log(1)")
+	assert.NotEmpty(t, resp.Header.Get("ETag"))
+	assert.Empty(t, resp.Header.Get("Last-Modified"))
+
+	// Directories are served by their index, and listings are off
+	resp = wolftest.NewRequest("GET", "/assets/docs/").Serve(a)
+	resp.AssertBody(t, "docs")
+	resp = wolftest.NewRequest("GET", "/assets/docs").Serve(a)
+	resp.AssertStatus(t, 301)
+	assert.Equal(t, "docs/", resp.Header.Get("Location"))
+	resp = wolftest.NewRequest("GET", "/assets/empty/").Serve(a)
+	resp.AssertStatus(t, 404)
+
+	resp = wolftest.NewRequest("GET", "/assets/nope.txt").Serve(a)
+	resp.AssertStatus(t, 404)
+	resp = wolftest.NewRequest("GET", "/assets/../static.go").Serve(a)
+	resp.AssertStatus(t, 404)
+}
+
+func TestStaticPrecompressed(t *testing.T) {
+	a := wolf.New()
+	a.Static("/assets", testFS)
+
+	resp := wolftest.NewRequest("GET", "/assets/app.js").WithHeader("Accept-Encoding", "br, gzip").Serve(a)
+	resp.AssertStatus(t, 200)
+	resp.AssertBody(t, "gzipped")
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Contains(t, resp.Header.Get("Content-Type"), "javascript")
+	assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+}
+
+func TestStaticOptions(t *testing.T) {
+	a := wolf.New()
+	a.StaticWithOptions("/", testFS, wolf.StaticOptions{
+		ListDirectories: true,
+		SPAFallback:     true,
+		MaxAge:          time.Hour,
+	})
+
+	var run bool
+	a.Get("/api/thing", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		run = true
+	})
+
+	// Other routes still work with a root prefix
+	wolftest.NewRequest("GET", "/api/thing").Serve(a)
+	assert.True(t, run)
+
+	resp := wolftest.NewRequest("GET", "/css/site.css").Serve(a)
+	resp.AssertBody(t, "body{}")
+	assert.Equal(t, "public, max-age=3600", resp.Header.Get("Cache-Control"))
+
+	resp = wolftest.NewRequest("GET", "/empty/").Serve(a)
+	resp.AssertStatus(t, 200)
+	resp.AssertBodyContains(t, `<a href="readme.txt">readme.txt</a>`)
+
+	// Unknown paths get the index page
+	resp = wolftest.NewRequest("GET", "/some/client/route").Serve(a)
+	resp.AssertStatus(t, 200)
+	resp.AssertBody(t, "<h1>index</h1>")
+	assert.Equal(t, "no-cache", resp.Header.Get("Cache-Control"))
+}
@@ -0,0 +1,33 @@
+package wolf
+
+import (
+	"sync/atomic"
+)
+
+// Process-wide counters, updated atomically.
+var (
+	stacksBuilt uint64
+	poolResets  uint64
+)
+
+// Stats contains counters of wolf's internal activity, for monitoring.  The
+// counts are for all Apps in the process.
+type Stats struct {
+	// StacksBuilt is the number of middleware stacks that have been built.
+	// Each App, and each handler returned by With, keeps a pool of built
+	// stacks; a new one is built when a request arrives and the pool is
+	// empty.  If this rises with every request, the pools aren't working.
+	StacksBuilt uint64
+
+	// PoolResets is the number of times that a pool of built stacks has
+	// been discarded, because middleware was added with App.Use.
+	PoolResets uint64
+}
+
+// ReadStats returns the current values of wolf's internal counters.
+func ReadStats() Stats {
+	return Stats{
+		StacksBuilt: atomic.LoadUint64(&stacksBuilt),
+		PoolResets:  atomic.LoadUint64(&poolResets),
+	}
+}
@@ -0,0 +1,25 @@
+package wolf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadStats(t *testing.T) {
+	before := ReadStats()
+
+	a := New()
+	a.Use(func(h http.Handler) http.Handler { return h })
+	a.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+
+	after := ReadStats()
+	assert.Equal(t, before.PoolResets+2, after.PoolResets)
+
+	// Building happens lazily, on the first request.
+	r, _ := http.NewRequest("GET", "/", nil)
+	a.ServeHTTP(httptest.NewRecorder(), r)
+	assert.True(t, ReadStats().StacksBuilt > before.StacksBuilt)
+}
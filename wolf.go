@@ -2,23 +2,67 @@ package wolf
 
 import (
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"golang.org/x/net/context"
 )
 
-// Internal private type for context key
-type private struct{}
+// Internal private type for context keys.  Keys are used by address, so the
+// type must not be zero-sized - otherwise different keys could compare equal.
+type private int
 
 // App is the base type for wolf.  It allows defining routes and adding
 // middleware, and implements the http.Handler interface.
 type App struct {
-	// RootContext is the root context for this App.  Middleware functions'
-	// context pointer defaults to pointing to this.
+	// RootContext is the root context for this App.  Each request is given
+	// its own context derived from this, which middleware functions' context
+	// pointer points to.  A request's context is cancelled when the client
+	// disconnects or the request finishes.
 	RootContext context.Context
 
+	// ShutdownTimeout is how long ListenAndServe and Serve will wait for
+	// in-flight requests to finish once a shutdown begins.  If zero,
+	// DefaultShutdownTimeout is used.
+	ShutdownTimeout time.Duration
+
 	router *httprouter.Router
 	stack  middlewareStack
+
+	// Route table, protected by routesMu.  Middleware may read it on every
+	// request, so it has its own lock.
+	routesMu   sync.RWMutex
+	routes     []Route
+	index      *httprouter.Router
+	skipRoutes int // the number of routes that skip middleware
+
+	// Lifecycle state, protected by mu
+	mu         sync.Mutex
+	onStart    []func() error
+	onShutdown []func()
+	shutdown   chan struct{}
+
+	// serving holds a servingContext.  It isn't protected by mu, since
+	// ServeHTTP loads it on every request.
+	serving atomic.Value
+}
+
+// servingContext is the context that Serve derives from RootContext, and
+// cancels when it finishes.  ctx is nil if the App isn't being served.
+type servingContext struct {
+	ctx context.Context
+}
+
+// rootContext returns the context that requests' contexts are derived from:
+// the one that Serve cancels if the App is being served, and RootContext
+// otherwise.
+func (a *App) rootContext() context.Context {
+	if sc, ok := a.serving.Load().(servingContext); ok && sc.ctx != nil {
+		return sc.ctx
+	}
+	return a.RootContext
 }
 
 // New creates a new App with a background context.
@@ -31,6 +75,7 @@ func New() *App {
 		RootContext: context.Background(),
 	}
 	ret.stack.app = ret
+	ret.stack.final = ret.dispatch
 	ret.stack.resetPool()
 	return ret
 }
@@ -42,6 +87,14 @@ func (a *App) Use(m MiddlewareType) {
 	a.stack.Push(m)
 }
 
+// MiddlewareNames returns the names of the middleware functions added with
+// Use, in the order that they run, for debugging.
+func (a *App) MiddlewareNames() []string {
+	a.stack.mu.Lock()
+	defer a.stack.mu.Unlock()
+	return append([]string{}, a.stack.names...)
+}
+
 // Compile will prepare the internal state of this App in order to serve
 // requests.  Calling this is not necessary, but will reduce latency when
 // serving the initial request(s).
@@ -49,7 +102,7 @@ func (a *App) Compile() {
 	const COMPILE_SIZE = 32
 
 	// Check out some number of middleware stacks.
-	stacks := make([]http.Handler, COMPILE_SIZE)
+	stacks := make([]*resolvedStack, COMPILE_SIZE)
 	for i := 0; i < COMPILE_SIZE; i++ {
 		stacks[i] = a.stack.get()
 	}
@@ -68,7 +121,29 @@ func (a *App) Compile() {
 // The app also provides shortcut methods for common HTTP methods (e.g. GET,
 // POST, DELETE, etc.)
 func (a *App) Handle(method, path string, handler HandlerType) {
-	a.router.Handle(method, path, a.wrapHandler(handler))
+	a.router.Handle(method, path, a.wrapHandler(path, handler))
+	a.addRoute(Route{
+		Method:     method,
+		Path:       path,
+		Metadata:   handlerMetadata(handler),
+		Middleware: handlerMiddleware(handler),
+	})
+}
+
+// HandleWithoutMiddleware registers a handler as Handle does, but requests
+// that match the route skip the App's middleware (added with Use).  It is for
+// handlers that must work whatever the middleware does, such as the debug
+// package's; use With to give them any middleware that they do need, such as
+// authentication.
+func (a *App) HandleWithoutMiddleware(method, path string, handler HandlerType) {
+	a.router.Handle(method, path, a.wrapHandler(path, handler))
+	a.addRoute(Route{
+		Method:         method,
+		Path:           path,
+		Metadata:       handlerMetadata(handler),
+		Middleware:     handlerMiddleware(handler),
+		skipMiddleware: true,
+	})
 }
 
 // Delete is a shortcut for app.Handle("DELETE", path, handler)
@@ -108,7 +183,29 @@ func (a *App) Put(path string, handler HandlerType) {
 
 // ServeHTTP makes this App implement the http.Handler interface.
 func (a *App) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithCancel(a.rootContext())
+	defer cancel()
+	ctx = newRouteContext(ctx, a)
+
+	// net/http cancels the request's context when the client goes away, so
+	// pass that on to our context.
+	if done := req.Context().Done(); done != nil {
+		go func() {
+			select {
+			case <-done:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	if a.skipsMiddleware(req) {
+		req.Body = &bodyWrapper{ctx: ctx, underlying: req.Body}
+		a.router.ServeHTTP(w, req)
+		return
+	}
+
 	m := a.stack.get()
-	m.ServeHTTP(w, req)
+	m.serve(ctx, w, req)
 	a.stack.release(m)
 }
@@ -2,8 +2,11 @@ package wolf
 
 import (
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 	"golang.org/x/net/context"
 )
 
@@ -23,3 +26,61 @@ func TestWolfHelpers(t *testing.T) {
 
 	a.Compile()
 }
+
+// Test that each request gets a fresh context derived from the root, which
+// is cancelled once the request is finished.
+func TestRequestContext(t *testing.T) {
+	a := New()
+	a.RootContext = context.WithValue(context.Background(), "root", "yes")
+
+	var counts []int
+	a.Use(func(ctx *context.Context, h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Values set by earlier requests mustn't leak into this one
+			n, _ := (*ctx).Value("count").(int)
+			*ctx = context.WithValue(*ctx, "count", n+1)
+			h.ServeHTTP(w, r)
+		})
+	})
+
+	var saved context.Context
+	a.Get("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "yes", ctx.Value("root"))
+		assert.NoError(t, ctx.Err())
+		counts = append(counts, ctx.Value("count").(int))
+		saved = ctx
+	})
+
+	for i := 0; i < 2; i++ {
+		r, _ := http.NewRequest("GET", "/", nil)
+		a.ServeHTTP(httptest.NewRecorder(), r)
+		assert.Equal(t, context.Canceled, saved.Err())
+	}
+	assert.Equal(t, []int{1, 1}, counts)
+}
+
+// Test that the request context is cancelled when the client goes away.
+func TestRequestContextDisconnect(t *testing.T) {
+	a := New()
+
+	cancelled := make(chan struct{})
+	a.Get("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-ctx.Done():
+			close(cancelled)
+		case <-time.After(time.Second):
+		}
+	})
+
+	reqCtx, cancel := context.WithCancel(context.Background())
+	r, _ := http.NewRequest("GET", "/", nil)
+	r = r.WithContext(reqCtx)
+	cancel()
+	a.ServeHTTP(httptest.NewRecorder(), r)
+
+	select {
+	case <-cancelled:
+	default:
+		t.Fatal("context was not cancelled")
+	}
+}
@@ -0,0 +1,141 @@
+package wolftest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf"
+)
+
+// Request builds a HTTP request for a test.  Its methods modify and return
+// the Request, so that calls can be chained.
+type Request struct {
+	method     string
+	target     string
+	header     http.Header
+	body       []byte
+	remoteAddr string
+	params     map[string]string
+	ctx        context.Context
+}
+
+// NewRequest starts building a request with the given method and target,
+// which may be a path or an absolute URL.
+func NewRequest(method, target string) *Request {
+	return &Request{
+		method: method,
+		target: target,
+		header: make(http.Header),
+		params: make(map[string]string),
+	}
+}
+
+// WithHeader adds a header to the request.
+func (r *Request) WithHeader(key, value string) *Request {
+	r.header.Add(key, value)
+	return r
+}
+
+// WithCookie adds a cookie to the request.
+func (r *Request) WithCookie(c *http.Cookie) *Request {
+	if s := c.String(); s != "" {
+		r.header.Add("Cookie", strings.SplitN(s, ";", 2)[0])
+	}
+	return r
+}
+
+// WithBody sets the body of the request.
+func (r *Request) WithBody(body string) *Request {
+	r.body = []byte(body)
+	return r
+}
+
+// WithJSON sets the body of the request to v encoded as JSON, along with the
+// appropriate Content-Type.  It panics if v cannot be encoded.
+func (r *Request) WithJSON(v interface{}) *Request {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		panic("wolftest: cannot encode JSON body: " + err.Error())
+	}
+
+	r.body = buf
+	r.header.Set("Content-Type", "application/json")
+	return r
+}
+
+// WithForm sets the body of the request to the URL-encoded form values, along
+// with the appropriate Content-Type.
+func (r *Request) WithForm(vals url.Values) *Request {
+	r.body = []byte(vals.Encode())
+	r.header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+// WithRemoteAddr sets the address that the request comes from, e.g.
+// "10.0.0.1:5000".  It defaults to "192.0.2.1:1234".
+func (r *Request) WithRemoteAddr(addr string) *Request {
+	r.remoteAddr = addr
+	return r
+}
+
+// WithParam sets a route parameter that is passed to the handler by Do.  It
+// has no effect on requests that go through a router.
+func (r *Request) WithParam(key, value string) *Request {
+	r.params[key] = value
+	return r
+}
+
+// WithContext sets the context that is passed to the handler by Do.  It
+// defaults to context.Background().
+func (r *Request) WithContext(ctx context.Context) *Request {
+	r.ctx = ctx
+	return r
+}
+
+// Build returns the request as a *http.Request suitable for passing to a
+// http.Handler.
+func (r *Request) Build() *http.Request {
+	var body io.Reader
+	if r.body != nil {
+		body = bytes.NewReader(r.body)
+	}
+
+	req := httptest.NewRequest(r.method, r.target, body)
+	if r.remoteAddr != "" {
+		req.RemoteAddr = r.remoteAddr
+	}
+	for k, v := range r.header {
+		req.Header[k] = append([]string(nil), v...)
+	}
+	return req
+}
+
+// Do calls the handler directly with this request and records the response.
+// The handler is passed the request's context along with any parameters set
+// with WithParam; no routing or middleware is involved.
+func (r *Request) Do(h wolf.HandlerType) *Response {
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx = WithParams(ctx, r.params)
+
+	rec := httptest.NewRecorder()
+	wolf.MakeHandler(h).ServeHTTPCtx(ctx, rec, r.Build())
+	return newRecordedResponse(rec)
+}
+
+// Serve passes this request to a http.Handler, such as a wolf.App, and
+// records the response.
+func (r *Request) Serve(h http.Handler) *Response {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r.Build())
+	return newRecordedResponse(rec)
+}
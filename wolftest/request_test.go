@@ -0,0 +1,77 @@
+package wolftest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf"
+)
+
+func TestRequestBuild(t *testing.T) {
+	r := NewRequest("POST", "/foo?a=b").
+		WithHeader("X-Foo", "bar").
+		WithCookie(&http.Cookie{Name: "session", Value: "abc"}).
+		WithJSON(map[string]int{"n": 1}).
+		Build()
+
+	assert.Equal(t, "POST", r.Method)
+	assert.Equal(t, "/foo", r.URL.Path)
+	assert.Equal(t, "b", r.URL.Query().Get("a"))
+	assert.Equal(t, "bar", r.Header.Get("X-Foo"))
+	assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+	assert.Equal(t, "192.0.2.1:1234", r.RemoteAddr)
+
+	c, err := r.Cookie("session")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", c.Value)
+
+	body, _ := ioutil.ReadAll(r.Body)
+	assert.Equal(t, `{"n":1}`, string(body))
+
+	r = NewRequest("POST", "/").WithForm(url.Values{"x": {"1"}}).Build()
+	assert.NoError(t, r.ParseForm())
+	assert.Equal(t, "1", r.PostForm.Get("x"))
+
+	r = NewRequest("GET", "/").WithRemoteAddr("10.0.0.1:5000").Build()
+	assert.Equal(t, "10.0.0.1:5000", r.RemoteAddr)
+}
+
+// Test that a handler can be called directly with params and a context.
+func TestRequestDo(t *testing.T) {
+	type key struct{}
+	h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		id, _ := wolf.ParamFrom(ctx, "id")
+		_, missing := wolf.ParamFrom(ctx, "missing")
+		assert.False(t, missing)
+		assert.Equal(t, "value", ctx.Value(key{}))
+
+		w.WriteHeader(201)
+		w.Write([]byte("user " + id))
+	}
+
+	resp := NewRequest("GET", "/users/42").
+		WithParam("id", "42").
+		WithContext(context.WithValue(context.Background(), key{}, "value")).
+		Do(h)
+	resp.AssertStatus(t, 201)
+	resp.AssertBody(t, "user 42")
+}
+
+// Test that requests can be sent through an App.
+func TestRequestServe(t *testing.T) {
+	a := wolf.New()
+	a.Get("/users/:id", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		id, _ := wolf.ParamFrom(ctx, "id")
+		w.Write([]byte("user " + id))
+	})
+
+	resp := NewRequest("GET", "/users/7").Serve(a)
+	resp.AssertStatus(t, 200)
+	resp.AssertBody(t, "user 7")
+}
@@ -0,0 +1,127 @@
+package wolftest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Response is a response that was received in a test, along with methods to
+// make assertions about it.  Each assertion reports a failure on the given
+// test and returns whether it succeeded.
+type Response struct {
+	// Code is the HTTP status code of the response.
+	Code int
+
+	// Header contains the response headers.
+	Header http.Header
+
+	// Body contains the response body.
+	Body []byte
+}
+
+func newRecordedResponse(rec *httptest.ResponseRecorder) *Response {
+	result := rec.Result()
+	return &Response{
+		Code:   result.StatusCode,
+		Header: result.Header,
+		Body:   rec.Body.Bytes(),
+	}
+}
+
+func newClientResponse(resp *http.Response) (*Response, error) {
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{
+		Code:   resp.StatusCode,
+		Header: resp.Header,
+		Body:   body,
+	}, nil
+}
+
+// Cookies returns the cookies set by the response.
+func (r *Response) Cookies() []*http.Cookie {
+	resp := http.Response{Header: r.Header}
+	return resp.Cookies()
+}
+
+// DecodeJSON decodes the body of the response into v.
+func (r *Response) DecodeJSON(v interface{}) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// AssertStatus checks the status code of the response.
+func (r *Response) AssertStatus(t testing.TB, code int) bool {
+	t.Helper()
+	if r.Code != code {
+		t.Errorf("expected status %d, got %d (body: %q)", code, r.Code, r.Body)
+		return false
+	}
+	return true
+}
+
+// AssertHeader checks that the response has a header with the given value.
+func (r *Response) AssertHeader(t testing.TB, key, value string) bool {
+	t.Helper()
+	if actual := r.Header.Get(key); actual != value {
+		t.Errorf("expected header %s to be %q, got %q", key, value, actual)
+		return false
+	}
+	return true
+}
+
+// AssertBody checks that the body of the response is exactly the given
+// string.
+func (r *Response) AssertBody(t testing.TB, body string) bool {
+	t.Helper()
+	if string(r.Body) != body {
+		t.Errorf("expected body %q, got %q", body, r.Body)
+		return false
+	}
+	return true
+}
+
+// AssertBodyContains checks that the body of the response contains the given
+// string.
+func (r *Response) AssertBodyContains(t testing.TB, s string) bool {
+	t.Helper()
+	if !strings.Contains(string(r.Body), s) {
+		t.Errorf("expected body to contain %q, got %q", s, r.Body)
+		return false
+	}
+	return true
+}
+
+// AssertJSON checks that the body of the response is JSON that is equivalent
+// to expected once both are encoded, ignoring formatting and key order.
+func (r *Response) AssertJSON(t testing.TB, expected interface{}) bool {
+	t.Helper()
+
+	buf, err := json.Marshal(expected)
+	if err != nil {
+		t.Errorf("cannot encode expected JSON: %s", err)
+		return false
+	}
+
+	var want, got interface{}
+	json.Unmarshal(buf, &want)
+	if err := json.Unmarshal(r.Body, &got); err != nil {
+		t.Errorf("response body is not valid JSON: %s (body: %q)", err, r.Body)
+		return false
+	}
+
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("expected JSON body %s, got %s", buf, r.Body)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package wolftest
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeT records failures instead of failing the test.
+type fakeT struct {
+	testing.TB
+	errors []string
+}
+
+func (f *fakeT) Helper() {}
+
+func (f *fakeT) Errorf(format string, args ...interface{}) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func TestResponseAssertions(t *testing.T) {
+	resp := &Response{
+		Code: 200,
+		Header: http.Header{
+			"Content-Type": {"application/json"},
+			"Set-Cookie":   {"a=b; Path=/"},
+		},
+		Body: []byte(`{"name": "alice", "tags": ["x"]}`),
+	}
+
+	ft := &fakeT{}
+	assert.True(t, resp.AssertStatus(ft, 200))
+	assert.True(t, resp.AssertHeader(ft, "Content-Type", "application/json"))
+	assert.True(t, resp.AssertBodyContains(ft, "alice"))
+	assert.True(t, resp.AssertJSON(ft, map[string]interface{}{
+		"tags": []string{"x"},
+		"name": "alice",
+	}))
+	assert.Empty(t, ft.errors)
+
+	assert.False(t, resp.AssertStatus(ft, 404))
+	assert.False(t, resp.AssertHeader(ft, "Content-Type", "text/html"))
+	assert.False(t, resp.AssertBody(ft, "nope"))
+	assert.False(t, resp.AssertBodyContains(ft, "bob"))
+	assert.False(t, resp.AssertJSON(ft, map[string]string{"name": "bob"}))
+	assert.Len(t, ft.errors, 5)
+
+	var v struct{ Name string }
+	assert.NoError(t, resp.DecodeJSON(&v))
+	assert.Equal(t, "alice", v.Name)
+
+	cookies := resp.Cookies()
+	assert.Len(t, cookies, 1)
+	assert.Equal(t, "b", cookies[0].Value)
+}
@@ -0,0 +1,94 @@
+package wolftest
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+)
+
+// DefaultURL is the base URL that a Server pretends to be served on.
+const DefaultURL = "http://example.com"
+
+// Server runs requests through a http.Handler in memory, as if it were being
+// served over the network.  Its Client has a cookie jar, so cookies set by
+// one response are sent with later requests.
+//
+// Since no connections are involved, handlers cannot hijack the connection
+// and streamed responses are only seen once the handler returns.
+type Server struct {
+	// URL is the base URL that relative request targets are resolved
+	// against.  It defaults to DefaultURL.
+	URL string
+
+	// Client is a HTTP client that sends all requests to the handler.
+	Client *http.Client
+}
+
+// NewServer creates a Server for the given handler.
+func NewServer(h http.Handler) *Server {
+	// cookiejar.New never returns an error without options.
+	jar, _ := cookiejar.New(nil)
+
+	return &Server{
+		URL: DefaultURL,
+		Client: &http.Client{
+			Transport: handlerTransport{h},
+			Jar:       jar,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Do sends a request through the Client and returns the response.  Redirects
+// are not followed.  It panics if the request cannot be made, which can only
+// happen if the request is malformed.
+func (s *Server) Do(r *Request) *Response {
+	req := r.Build()
+
+	// Turn the server-side request into a client-side one.
+	if strings.HasPrefix(r.target, "/") {
+		u, err := req.URL.Parse(s.URL + r.target)
+		if err != nil {
+			panic("wolftest: invalid request target: " + err.Error())
+		}
+		req.URL = u
+		req.Host = u.Host
+	}
+	req.RequestURI = ""
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		panic("wolftest: request failed: " + err.Error())
+	}
+
+	ret, err := newClientResponse(resp)
+	if err != nil {
+		panic("wolftest: reading response failed: " + err.Error())
+	}
+	return ret
+}
+
+// handlerTransport is a http.RoundTripper that calls a handler directly.
+type handlerTransport struct {
+	h http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Make the request look like one a server would receive.
+	sreq := req.Clone(req.Context())
+	sreq.RequestURI = req.URL.RequestURI()
+	sreq.RemoteAddr = "192.0.2.1:1234"
+	if sreq.Body == nil {
+		sreq.Body = http.NoBody
+	}
+
+	rec := httptest.NewRecorder()
+	t.h.ServeHTTP(rec, sreq)
+
+	resp := rec.Result()
+	resp.Request = req
+	return resp, nil
+}
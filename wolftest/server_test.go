@@ -0,0 +1,41 @@
+package wolftest
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf"
+)
+
+// Test that the server keeps cookies between requests.
+func TestServerCookies(t *testing.T) {
+	a := wolf.New()
+	a.Post("/login", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "user", Value: "alice", Path: "/"})
+		http.Redirect(w, r, "/account", http.StatusSeeOther)
+	})
+	a.Get("/account", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		c, err := r.Cookie("user")
+		if err != nil {
+			http.Error(w, "not logged in", 401)
+			return
+		}
+		assert.Equal(t, "192.0.2.1:1234", r.RemoteAddr)
+		w.Write([]byte("hello " + c.Value))
+	})
+
+	srv := NewServer(a)
+
+	srv.Do(NewRequest("GET", "/account")).AssertStatus(t, 401)
+
+	resp := srv.Do(NewRequest("POST", "/login"))
+	resp.AssertStatus(t, http.StatusSeeOther)
+	resp.AssertHeader(t, "Location", "/account")
+
+	resp = srv.Do(NewRequest("GET", "/account"))
+	resp.AssertStatus(t, 200)
+	resp.AssertBody(t, "hello alice")
+}
@@ -0,0 +1,44 @@
+// Package wolftest provides utilities for testing wolf handlers and Apps.
+//
+// Handlers can be called directly, without a router or middleware:
+//
+//	resp := wolftest.NewRequest("GET", "/users/42").
+//		WithParam("id", "42").
+//		Do(getUser)
+//	resp.AssertStatus(t, 200)
+//	resp.AssertBodyContains(t, "Alice")
+//
+// Or an entire App can be exercised through a Server, which keeps cookies
+// between requests:
+//
+//	srv := wolftest.NewServer(app)
+//	srv.Do(wolftest.NewRequest("POST", "/login").WithForm(creds))
+//	srv.Do(wolftest.NewRequest("GET", "/account")).AssertStatus(t, 200)
+package wolftest
+
+import (
+	"sort"
+
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf"
+)
+
+// WithParams returns a copy of ctx containing the given route parameters, so
+// that a handler called with it can use wolf.ParamFrom.
+func WithParams(ctx context.Context, params map[string]string) context.Context {
+	// Sort the keys so that the result doesn't depend on map ordering
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	p := make(httprouter.Params, 0, len(params))
+	for _, k := range keys {
+		p = append(p, httprouter.Param{Key: k, Value: params[k]})
+	}
+
+	return wolf.NewParamsContext(ctx, p)
+}
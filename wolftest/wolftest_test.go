@@ -0,0 +1,25 @@
+package wolftest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/andrew-d/wolf"
+)
+
+func TestWithParams(t *testing.T) {
+	ctx := WithParams(context.Background(), map[string]string{
+		"id":   "42",
+		"name": "alice",
+	})
+
+	val, ok := wolf.ParamFrom(ctx, "id")
+	assert.True(t, ok)
+	assert.Equal(t, "42", val)
+
+	val, ok = wolf.ParamFrom(ctx, "name")
+	assert.True(t, ok)
+	assert.Equal(t, "alice", val)
+}